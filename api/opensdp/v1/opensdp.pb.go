@@ -0,0 +1,1148 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: opensdp/v1/opensdp.proto
+
+// gRPC API of the OpenSDP server. Clients authenticate using mutual TLS, the
+// device ID is taken from the client certificate (same as the HTTPS JSON API).
+
+package opensdpv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Port range of a service. Protocols without ports (eg. icmp) leave start and
+// end unset.
+type PortRange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Protocol      string                 `protobuf:"bytes,1,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Start         uint32                 `protobuf:"varint,2,opt,name=start,proto3" json:"start,omitempty"`
+	End           uint32                 `protobuf:"varint,3,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PortRange) Reset() {
+	*x = PortRange{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PortRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PortRange) ProtoMessage() {}
+
+func (x *PortRange) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PortRange.ProtoReflect.Descriptor instead.
+func (*PortRange) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PortRange) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *PortRange) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *PortRange) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+type Service struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Ip            string                 `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
+	Ports         []*PortRange           `protobuf:"bytes,3,rep,name=ports,proto3" json:"ports,omitempty"`
+	Tags          []string               `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	AccessType    []string               `protobuf:"bytes,5,rep,name=access_type,json=accessType,proto3" json:"access_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Service) Reset() {
+	*x = Service{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Service) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Service) ProtoMessage() {}
+
+func (x *Service) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Service.ProtoReflect.Descriptor instead.
+func (*Service) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Service) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Service) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Service) GetPorts() []*PortRange {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *Service) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Service) GetAccessType() []string {
+	if x != nil {
+		return x.AccessType
+	}
+	return nil
+}
+
+type Client struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Label         string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Services      []string               `protobuf:"bytes,3,rep,name=services,proto3" json:"services,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Client) Reset() {
+	*x = Client{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Client) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Client) ProtoMessage() {}
+
+func (x *Client) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Client.ProtoReflect.Descriptor instead.
+func (*Client) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Client) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Client) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Client) GetServices() []string {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+// Posture requirement of a withheld service that the device does not meet
+type PostureFailure struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Service string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Fact    string                 `protobuf:"bytes,2,opt,name=fact,proto3" json:"fact,omitempty"`
+	// Condition the fact has to meet, eg. ">= 13.4"
+	Requirement string `protobuf:"bytes,3,opt,name=requirement,proto3" json:"requirement,omitempty"`
+	// Submitted value, empty if not submitted
+	Actual        string `protobuf:"bytes,4,opt,name=actual,proto3" json:"actual,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostureFailure) Reset() {
+	*x = PostureFailure{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostureFailure) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostureFailure) ProtoMessage() {}
+
+func (x *PostureFailure) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostureFailure.ProtoReflect.Descriptor instead.
+func (*PostureFailure) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PostureFailure) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *PostureFailure) GetFact() string {
+	if x != nil {
+		return x.Fact
+	}
+	return ""
+}
+
+func (x *PostureFailure) GetRequirement() string {
+	if x != nil {
+		return x.Requirement
+	}
+	return ""
+}
+
+func (x *PostureFailure) GetActual() string {
+	if x != nil {
+		return x.Actual
+	}
+	return ""
+}
+
+type DiscoverRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Posture facts of the device, eg. disk-encryption: "true"
+	Posture       map[string]string `protobuf:"bytes,1,rep,name=posture,proto3" json:"posture,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DiscoverRequest) Reset() {
+	*x = DiscoverRequest{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiscoverRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiscoverRequest) ProtoMessage() {}
+
+func (x *DiscoverRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiscoverRequest.ProtoReflect.Descriptor instead.
+func (*DiscoverRequest) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DiscoverRequest) GetPosture() map[string]string {
+	if x != nil {
+		return x.Posture
+	}
+	return nil
+}
+
+type DiscoverResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Services []*Service             `protobuf:"bytes,2,rep,name=services,proto3" json:"services,omitempty"`
+	// Unmet posture requirements of the services withheld from the device
+	PostureFailures []*PostureFailure `protobuf:"bytes,3,rep,name=posture_failures,json=postureFailures,proto3" json:"posture_failures,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *DiscoverResponse) Reset() {
+	*x = DiscoverResponse{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiscoverResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiscoverResponse) ProtoMessage() {}
+
+func (x *DiscoverResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiscoverResponse.ProtoReflect.Descriptor instead.
+func (*DiscoverResponse) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DiscoverResponse) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *DiscoverResponse) GetServices() []*Service {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+func (x *DiscoverResponse) GetPostureFailures() []*PostureFailure {
+	if x != nil {
+		return x.PostureFailures
+	}
+	return nil
+}
+
+type WatchServicesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Posture facts of the device, eg. disk-encryption: "true"
+	Posture       map[string]string `protobuf:"bytes,1,rep,name=posture,proto3" json:"posture,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchServicesRequest) Reset() {
+	*x = WatchServicesRequest{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchServicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchServicesRequest) ProtoMessage() {}
+
+func (x *WatchServicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchServicesRequest.ProtoReflect.Descriptor instead.
+func (*WatchServicesRequest) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchServicesRequest) GetPosture() map[string]string {
+	if x != nil {
+		return x.Posture
+	}
+	return nil
+}
+
+type ReloadConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadConfigRequest) Reset() {
+	*x = ReloadConfigRequest{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadConfigRequest) ProtoMessage() {}
+
+func (x *ReloadConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadConfigRequest.ProtoReflect.Descriptor instead.
+func (*ReloadConfigRequest) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{7}
+}
+
+type ReloadConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Services      int32                  `protobuf:"varint,1,opt,name=services,proto3" json:"services,omitempty"`
+	Clients       int32                  `protobuf:"varint,2,opt,name=clients,proto3" json:"clients,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadConfigResponse) Reset() {
+	*x = ReloadConfigResponse{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadConfigResponse) ProtoMessage() {}
+
+func (x *ReloadConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadConfigResponse.ProtoReflect.Descriptor instead.
+func (*ReloadConfigResponse) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ReloadConfigResponse) GetServices() int32 {
+	if x != nil {
+		return x.Services
+	}
+	return 0
+}
+
+func (x *ReloadConfigResponse) GetClients() int32 {
+	if x != nil {
+		return x.Clients
+	}
+	return 0
+}
+
+type ListServicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListServicesRequest) Reset() {
+	*x = ListServicesRequest{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListServicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListServicesRequest) ProtoMessage() {}
+
+func (x *ListServicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListServicesRequest.ProtoReflect.Descriptor instead.
+func (*ListServicesRequest) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{9}
+}
+
+type ListServicesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Services      []*Service             `protobuf:"bytes,1,rep,name=services,proto3" json:"services,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListServicesResponse) Reset() {
+	*x = ListServicesResponse{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListServicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListServicesResponse) ProtoMessage() {}
+
+func (x *ListServicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListServicesResponse.ProtoReflect.Descriptor instead.
+func (*ListServicesResponse) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListServicesResponse) GetServices() []*Service {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+type ListClientsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListClientsRequest) Reset() {
+	*x = ListClientsRequest{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListClientsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListClientsRequest) ProtoMessage() {}
+
+func (x *ListClientsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListClientsRequest.ProtoReflect.Descriptor instead.
+func (*ListClientsRequest) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{11}
+}
+
+type ListClientsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Clients       []*Client              `protobuf:"bytes,1,rep,name=clients,proto3" json:"clients,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListClientsResponse) Reset() {
+	*x = ListClientsResponse{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListClientsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListClientsResponse) ProtoMessage() {}
+
+func (x *ListClientsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListClientsResponse.ProtoReflect.Descriptor instead.
+func (*ListClientsResponse) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListClientsResponse) GetClients() []*Client {
+	if x != nil {
+		return x.Clients
+	}
+	return nil
+}
+
+type ExplainPolicyRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// Simulated peer IP, none if unset
+	PeerIp string `protobuf:"bytes,2,opt,name=peer_ip,json=peerIp,proto3" json:"peer_ip,omitempty"`
+	// Simulated time, the current time if unset
+	Time *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	// Simulated posture facts
+	Posture map[string]string `protobuf:"bytes,4,rep,name=posture,proto3" json:"posture,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Simulated client certificate (DER), cert.* attributes are empty if unset
+	Certificate   []byte `protobuf:"bytes,5,opt,name=certificate,proto3" json:"certificate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainPolicyRequest) Reset() {
+	*x = ExplainPolicyRequest{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainPolicyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainPolicyRequest) ProtoMessage() {}
+
+func (x *ExplainPolicyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainPolicyRequest.ProtoReflect.Descriptor instead.
+func (*ExplainPolicyRequest) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ExplainPolicyRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *ExplainPolicyRequest) GetPeerIp() string {
+	if x != nil {
+		return x.PeerIp
+	}
+	return ""
+}
+
+func (x *ExplainPolicyRequest) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *ExplainPolicyRequest) GetPosture() map[string]string {
+	if x != nil {
+		return x.Posture
+	}
+	return nil
+}
+
+func (x *ExplainPolicyRequest) GetCertificate() []byte {
+	if x != nil {
+		return x.Certificate
+	}
+	return nil
+}
+
+// Policy rule evaluated for a service
+type RuleEvaluation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The rule as in the services file, eg. "allow: peer.ip in \"10.0.0.0/8\""
+	Rule    string `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
+	Matched bool   `protobuf:"varint,2,opt,name=matched,proto3" json:"matched,omitempty"`
+	// Evaluation error, which denies the service
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RuleEvaluation) Reset() {
+	*x = RuleEvaluation{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RuleEvaluation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RuleEvaluation) ProtoMessage() {}
+
+func (x *RuleEvaluation) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RuleEvaluation.ProtoReflect.Descriptor instead.
+func (*RuleEvaluation) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RuleEvaluation) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *RuleEvaluation) GetMatched() bool {
+	if x != nil {
+		return x.Matched
+	}
+	return false
+}
+
+func (x *RuleEvaluation) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ServiceDecision struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Service string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Allowed bool                   `protobuf:"varint,2,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	// Listed for the device in the clients file
+	Listed bool `protobuf:"varint,3,opt,name=listed,proto3" json:"listed,omitempty"`
+	// Rules evaluated up to and including the deciding one
+	Rules           []*RuleEvaluation `protobuf:"bytes,4,rep,name=rules,proto3" json:"rules,omitempty"`
+	Reason          string            `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`
+	PostureFailures []*PostureFailure `protobuf:"bytes,6,rep,name=posture_failures,json=postureFailures,proto3" json:"posture_failures,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ServiceDecision) Reset() {
+	*x = ServiceDecision{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServiceDecision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceDecision) ProtoMessage() {}
+
+func (x *ServiceDecision) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceDecision.ProtoReflect.Descriptor instead.
+func (*ServiceDecision) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ServiceDecision) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *ServiceDecision) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *ServiceDecision) GetListed() bool {
+	if x != nil {
+		return x.Listed
+	}
+	return false
+}
+
+func (x *ServiceDecision) GetRules() []*RuleEvaluation {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+func (x *ServiceDecision) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *ServiceDecision) GetPostureFailures() []*PostureFailure {
+	if x != nil {
+		return x.PostureFailures
+	}
+	return nil
+}
+
+type ExplainPolicyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Services      []*ServiceDecision     `protobuf:"bytes,2,rep,name=services,proto3" json:"services,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainPolicyResponse) Reset() {
+	*x = ExplainPolicyResponse{}
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainPolicyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainPolicyResponse) ProtoMessage() {}
+
+func (x *ExplainPolicyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opensdp_v1_opensdp_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainPolicyResponse.ProtoReflect.Descriptor instead.
+func (*ExplainPolicyResponse) Descriptor() ([]byte, []int) {
+	return file_opensdp_v1_opensdp_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ExplainPolicyResponse) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *ExplainPolicyResponse) GetServices() []*ServiceDecision {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+var File_opensdp_v1_opensdp_proto protoreflect.FileDescriptor
+
+const file_opensdp_v1_opensdp_proto_rawDesc = "" +
+	"\n" +
+	"\x18opensdp/v1/opensdp.proto\x12\n" +
+	"opensdp.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"O\n" +
+	"\tPortRange\x12\x1a\n" +
+	"\bprotocol\x18\x01 \x01(\tR\bprotocol\x12\x14\n" +
+	"\x05start\x18\x02 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x03 \x01(\rR\x03end\"\x8f\x01\n" +
+	"\aService\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02ip\x18\x02 \x01(\tR\x02ip\x12+\n" +
+	"\x05ports\x18\x03 \x03(\v2\x15.opensdp.v1.PortRangeR\x05ports\x12\x12\n" +
+	"\x04tags\x18\x04 \x03(\tR\x04tags\x12\x1f\n" +
+	"\vaccess_type\x18\x05 \x03(\tR\n" +
+	"accessType\"W\n" +
+	"\x06Client\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x1a\n" +
+	"\bservices\x18\x03 \x03(\tR\bservices\"x\n" +
+	"\x0ePostureFailure\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x12\n" +
+	"\x04fact\x18\x02 \x01(\tR\x04fact\x12 \n" +
+	"\vrequirement\x18\x03 \x01(\tR\vrequirement\x12\x16\n" +
+	"\x06actual\x18\x04 \x01(\tR\x06actual\"\x91\x01\n" +
+	"\x0fDiscoverRequest\x12B\n" +
+	"\aposture\x18\x01 \x03(\v2(.opensdp.v1.DiscoverRequest.PostureEntryR\aposture\x1a:\n" +
+	"\fPostureEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa7\x01\n" +
+	"\x10DiscoverResponse\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12/\n" +
+	"\bservices\x18\x02 \x03(\v2\x13.opensdp.v1.ServiceR\bservices\x12E\n" +
+	"\x10posture_failures\x18\x03 \x03(\v2\x1a.opensdp.v1.PostureFailureR\x0fpostureFailures\"\x9b\x01\n" +
+	"\x14WatchServicesRequest\x12G\n" +
+	"\aposture\x18\x01 \x03(\v2-.opensdp.v1.WatchServicesRequest.PostureEntryR\aposture\x1a:\n" +
+	"\fPostureEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x15\n" +
+	"\x13ReloadConfigRequest\"L\n" +
+	"\x14ReloadConfigResponse\x12\x1a\n" +
+	"\bservices\x18\x01 \x01(\x05R\bservices\x12\x18\n" +
+	"\aclients\x18\x02 \x01(\x05R\aclients\"\x15\n" +
+	"\x13ListServicesRequest\"G\n" +
+	"\x14ListServicesResponse\x12/\n" +
+	"\bservices\x18\x01 \x03(\v2\x13.opensdp.v1.ServiceR\bservices\"\x14\n" +
+	"\x12ListClientsRequest\"C\n" +
+	"\x13ListClientsResponse\x12,\n" +
+	"\aclients\x18\x01 \x03(\v2\x12.opensdp.v1.ClientR\aclients\"\xa3\x02\n" +
+	"\x14ExplainPolicyRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x17\n" +
+	"\apeer_ip\x18\x02 \x01(\tR\x06peerIp\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12G\n" +
+	"\aposture\x18\x04 \x03(\v2-.opensdp.v1.ExplainPolicyRequest.PostureEntryR\aposture\x12 \n" +
+	"\vcertificate\x18\x05 \x01(\fR\vcertificate\x1a:\n" +
+	"\fPostureEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"T\n" +
+	"\x0eRuleEvaluation\x12\x12\n" +
+	"\x04rule\x18\x01 \x01(\tR\x04rule\x12\x18\n" +
+	"\amatched\x18\x02 \x01(\bR\amatched\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\xee\x01\n" +
+	"\x0fServiceDecision\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x18\n" +
+	"\aallowed\x18\x02 \x01(\bR\aallowed\x12\x16\n" +
+	"\x06listed\x18\x03 \x01(\bR\x06listed\x120\n" +
+	"\x05rules\x18\x04 \x03(\v2\x1a.opensdp.v1.RuleEvaluationR\x05rules\x12\x16\n" +
+	"\x06reason\x18\x05 \x01(\tR\x06reason\x12E\n" +
+	"\x10posture_failures\x18\x06 \x03(\v2\x1a.opensdp.v1.PostureFailureR\x0fpostureFailures\"m\n" +
+	"\x15ExplainPolicyResponse\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x127\n" +
+	"\bservices\x18\x02 \x03(\v2\x1b.opensdp.v1.ServiceDecisionR\bservices2\xef\x03\n" +
+	"\aOpenSDP\x12E\n" +
+	"\bDiscover\x12\x1b.opensdp.v1.DiscoverRequest\x1a\x1c.opensdp.v1.DiscoverResponse\x12Q\n" +
+	"\rWatchServices\x12 .opensdp.v1.WatchServicesRequest\x1a\x1c.opensdp.v1.DiscoverResponse0\x01\x12Q\n" +
+	"\fReloadConfig\x12\x1f.opensdp.v1.ReloadConfigRequest\x1a .opensdp.v1.ReloadConfigResponse\x12Q\n" +
+	"\fListServices\x12\x1f.opensdp.v1.ListServicesRequest\x1a .opensdp.v1.ListServicesResponse\x12N\n" +
+	"\vListClients\x12\x1e.opensdp.v1.ListClientsRequest\x1a\x1f.opensdp.v1.ListClientsResponse\x12T\n" +
+	"\rExplainPolicy\x12 .opensdp.v1.ExplainPolicyRequest\x1a!.opensdp.v1.ExplainPolicyResponseB9Z7github.com/greenstatic/opensdp/api/opensdp/v1;opensdpv1b\x06proto3"
+
+var (
+	file_opensdp_v1_opensdp_proto_rawDescOnce sync.Once
+	file_opensdp_v1_opensdp_proto_rawDescData []byte
+)
+
+func file_opensdp_v1_opensdp_proto_rawDescGZIP() []byte {
+	file_opensdp_v1_opensdp_proto_rawDescOnce.Do(func() {
+		file_opensdp_v1_opensdp_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_opensdp_v1_opensdp_proto_rawDesc), len(file_opensdp_v1_opensdp_proto_rawDesc)))
+	})
+	return file_opensdp_v1_opensdp_proto_rawDescData
+}
+
+var file_opensdp_v1_opensdp_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
+var file_opensdp_v1_opensdp_proto_goTypes = []any{
+	(*PortRange)(nil),             // 0: opensdp.v1.PortRange
+	(*Service)(nil),               // 1: opensdp.v1.Service
+	(*Client)(nil),                // 2: opensdp.v1.Client
+	(*PostureFailure)(nil),        // 3: opensdp.v1.PostureFailure
+	(*DiscoverRequest)(nil),       // 4: opensdp.v1.DiscoverRequest
+	(*DiscoverResponse)(nil),      // 5: opensdp.v1.DiscoverResponse
+	(*WatchServicesRequest)(nil),  // 6: opensdp.v1.WatchServicesRequest
+	(*ReloadConfigRequest)(nil),   // 7: opensdp.v1.ReloadConfigRequest
+	(*ReloadConfigResponse)(nil),  // 8: opensdp.v1.ReloadConfigResponse
+	(*ListServicesRequest)(nil),   // 9: opensdp.v1.ListServicesRequest
+	(*ListServicesResponse)(nil),  // 10: opensdp.v1.ListServicesResponse
+	(*ListClientsRequest)(nil),    // 11: opensdp.v1.ListClientsRequest
+	(*ListClientsResponse)(nil),   // 12: opensdp.v1.ListClientsResponse
+	(*ExplainPolicyRequest)(nil),  // 13: opensdp.v1.ExplainPolicyRequest
+	(*RuleEvaluation)(nil),        // 14: opensdp.v1.RuleEvaluation
+	(*ServiceDecision)(nil),       // 15: opensdp.v1.ServiceDecision
+	(*ExplainPolicyResponse)(nil), // 16: opensdp.v1.ExplainPolicyResponse
+	nil,                           // 17: opensdp.v1.DiscoverRequest.PostureEntry
+	nil,                           // 18: opensdp.v1.WatchServicesRequest.PostureEntry
+	nil,                           // 19: opensdp.v1.ExplainPolicyRequest.PostureEntry
+	(*timestamppb.Timestamp)(nil), // 20: google.protobuf.Timestamp
+}
+var file_opensdp_v1_opensdp_proto_depIdxs = []int32{
+	0,  // 0: opensdp.v1.Service.ports:type_name -> opensdp.v1.PortRange
+	17, // 1: opensdp.v1.DiscoverRequest.posture:type_name -> opensdp.v1.DiscoverRequest.PostureEntry
+	1,  // 2: opensdp.v1.DiscoverResponse.services:type_name -> opensdp.v1.Service
+	3,  // 3: opensdp.v1.DiscoverResponse.posture_failures:type_name -> opensdp.v1.PostureFailure
+	18, // 4: opensdp.v1.WatchServicesRequest.posture:type_name -> opensdp.v1.WatchServicesRequest.PostureEntry
+	1,  // 5: opensdp.v1.ListServicesResponse.services:type_name -> opensdp.v1.Service
+	2,  // 6: opensdp.v1.ListClientsResponse.clients:type_name -> opensdp.v1.Client
+	20, // 7: opensdp.v1.ExplainPolicyRequest.time:type_name -> google.protobuf.Timestamp
+	19, // 8: opensdp.v1.ExplainPolicyRequest.posture:type_name -> opensdp.v1.ExplainPolicyRequest.PostureEntry
+	14, // 9: opensdp.v1.ServiceDecision.rules:type_name -> opensdp.v1.RuleEvaluation
+	3,  // 10: opensdp.v1.ServiceDecision.posture_failures:type_name -> opensdp.v1.PostureFailure
+	15, // 11: opensdp.v1.ExplainPolicyResponse.services:type_name -> opensdp.v1.ServiceDecision
+	4,  // 12: opensdp.v1.OpenSDP.Discover:input_type -> opensdp.v1.DiscoverRequest
+	6,  // 13: opensdp.v1.OpenSDP.WatchServices:input_type -> opensdp.v1.WatchServicesRequest
+	7,  // 14: opensdp.v1.OpenSDP.ReloadConfig:input_type -> opensdp.v1.ReloadConfigRequest
+	9,  // 15: opensdp.v1.OpenSDP.ListServices:input_type -> opensdp.v1.ListServicesRequest
+	11, // 16: opensdp.v1.OpenSDP.ListClients:input_type -> opensdp.v1.ListClientsRequest
+	13, // 17: opensdp.v1.OpenSDP.ExplainPolicy:input_type -> opensdp.v1.ExplainPolicyRequest
+	5,  // 18: opensdp.v1.OpenSDP.Discover:output_type -> opensdp.v1.DiscoverResponse
+	5,  // 19: opensdp.v1.OpenSDP.WatchServices:output_type -> opensdp.v1.DiscoverResponse
+	8,  // 20: opensdp.v1.OpenSDP.ReloadConfig:output_type -> opensdp.v1.ReloadConfigResponse
+	10, // 21: opensdp.v1.OpenSDP.ListServices:output_type -> opensdp.v1.ListServicesResponse
+	12, // 22: opensdp.v1.OpenSDP.ListClients:output_type -> opensdp.v1.ListClientsResponse
+	16, // 23: opensdp.v1.OpenSDP.ExplainPolicy:output_type -> opensdp.v1.ExplainPolicyResponse
+	18, // [18:24] is the sub-list for method output_type
+	12, // [12:18] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_opensdp_v1_opensdp_proto_init() }
+func file_opensdp_v1_opensdp_proto_init() {
+	if File_opensdp_v1_opensdp_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_opensdp_v1_opensdp_proto_rawDesc), len(file_opensdp_v1_opensdp_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   20,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_opensdp_v1_opensdp_proto_goTypes,
+		DependencyIndexes: file_opensdp_v1_opensdp_proto_depIdxs,
+		MessageInfos:      file_opensdp_v1_opensdp_proto_msgTypes,
+	}.Build()
+	File_opensdp_v1_opensdp_proto = out.File
+	file_opensdp_v1_opensdp_proto_goTypes = nil
+	file_opensdp_v1_opensdp_proto_depIdxs = nil
+}
@@ -0,0 +1,340 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: opensdp/v1/opensdp.proto
+
+// gRPC API of the OpenSDP server. Clients authenticate using mutual TLS, the
+// device ID is taken from the client certificate (same as the HTTPS JSON API).
+
+package opensdpv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	OpenSDP_Discover_FullMethodName      = "/opensdp.v1.OpenSDP/Discover"
+	OpenSDP_WatchServices_FullMethodName = "/opensdp.v1.OpenSDP/WatchServices"
+	OpenSDP_ReloadConfig_FullMethodName  = "/opensdp.v1.OpenSDP/ReloadConfig"
+	OpenSDP_ListServices_FullMethodName  = "/opensdp.v1.OpenSDP/ListServices"
+	OpenSDP_ListClients_FullMethodName   = "/opensdp.v1.OpenSDP/ListClients"
+	OpenSDP_ExplainPolicy_FullMethodName = "/opensdp.v1.OpenSDP/ExplainPolicy"
+)
+
+// OpenSDPClient is the client API for OpenSDP service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OpenSDPClient interface {
+	// Services the device is authorized for. Fails with PERMISSION_DENIED if
+	// there are none, or the posture requirements withhold all of them.
+	Discover(ctx context.Context, in *DiscoverRequest, opts ...grpc.CallOption) (*DiscoverResponse, error)
+	// Streams the services the device is authorized for, starting with the
+	// current set and followed by a new set whenever the device's policy
+	// changes. The stream ends once the posture is older than the server's
+	// posture-max-age, clients call again with freshly collected posture.
+	WatchServices(ctx context.Context, in *WatchServicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DiscoverResponse], error)
+	// Reloads the services and clients config files
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
+	// Lists all configured services
+	ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error)
+	// Lists all configured clients and the names of their authorized services
+	ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error)
+	// Explains why each service is given to or withheld from a device, given
+	// simulated request attributes
+	ExplainPolicy(ctx context.Context, in *ExplainPolicyRequest, opts ...grpc.CallOption) (*ExplainPolicyResponse, error)
+}
+
+type openSDPClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOpenSDPClient(cc grpc.ClientConnInterface) OpenSDPClient {
+	return &openSDPClient{cc}
+}
+
+func (c *openSDPClient) Discover(ctx context.Context, in *DiscoverRequest, opts ...grpc.CallOption) (*DiscoverResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DiscoverResponse)
+	err := c.cc.Invoke(ctx, OpenSDP_Discover_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openSDPClient) WatchServices(ctx context.Context, in *WatchServicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DiscoverResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OpenSDP_ServiceDesc.Streams[0], OpenSDP_WatchServices_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchServicesRequest, DiscoverResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OpenSDP_WatchServicesClient = grpc.ServerStreamingClient[DiscoverResponse]
+
+func (c *openSDPClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReloadConfigResponse)
+	err := c.cc.Invoke(ctx, OpenSDP_ReloadConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openSDPClient) ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListServicesResponse)
+	err := c.cc.Invoke(ctx, OpenSDP_ListServices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openSDPClient) ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListClientsResponse)
+	err := c.cc.Invoke(ctx, OpenSDP_ListClients_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openSDPClient) ExplainPolicy(ctx context.Context, in *ExplainPolicyRequest, opts ...grpc.CallOption) (*ExplainPolicyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExplainPolicyResponse)
+	err := c.cc.Invoke(ctx, OpenSDP_ExplainPolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OpenSDPServer is the server API for OpenSDP service.
+// All implementations must embed UnimplementedOpenSDPServer
+// for forward compatibility.
+type OpenSDPServer interface {
+	// Services the device is authorized for. Fails with PERMISSION_DENIED if
+	// there are none, or the posture requirements withhold all of them.
+	Discover(context.Context, *DiscoverRequest) (*DiscoverResponse, error)
+	// Streams the services the device is authorized for, starting with the
+	// current set and followed by a new set whenever the device's policy
+	// changes. The stream ends once the posture is older than the server's
+	// posture-max-age, clients call again with freshly collected posture.
+	WatchServices(*WatchServicesRequest, grpc.ServerStreamingServer[DiscoverResponse]) error
+	// Reloads the services and clients config files
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
+	// Lists all configured services
+	ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error)
+	// Lists all configured clients and the names of their authorized services
+	ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error)
+	// Explains why each service is given to or withheld from a device, given
+	// simulated request attributes
+	ExplainPolicy(context.Context, *ExplainPolicyRequest) (*ExplainPolicyResponse, error)
+	mustEmbedUnimplementedOpenSDPServer()
+}
+
+// UnimplementedOpenSDPServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOpenSDPServer struct{}
+
+func (UnimplementedOpenSDPServer) Discover(context.Context, *DiscoverRequest) (*DiscoverResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Discover not implemented")
+}
+func (UnimplementedOpenSDPServer) WatchServices(*WatchServicesRequest, grpc.ServerStreamingServer[DiscoverResponse]) error {
+	return status.Error(codes.Unimplemented, "method WatchServices not implemented")
+}
+func (UnimplementedOpenSDPServer) ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReloadConfig not implemented")
+}
+func (UnimplementedOpenSDPServer) ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListServices not implemented")
+}
+func (UnimplementedOpenSDPServer) ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListClients not implemented")
+}
+func (UnimplementedOpenSDPServer) ExplainPolicy(context.Context, *ExplainPolicyRequest) (*ExplainPolicyResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ExplainPolicy not implemented")
+}
+func (UnimplementedOpenSDPServer) mustEmbedUnimplementedOpenSDPServer() {}
+func (UnimplementedOpenSDPServer) testEmbeddedByValue()                 {}
+
+// UnsafeOpenSDPServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OpenSDPServer will
+// result in compilation errors.
+type UnsafeOpenSDPServer interface {
+	mustEmbedUnimplementedOpenSDPServer()
+}
+
+func RegisterOpenSDPServer(s grpc.ServiceRegistrar, srv OpenSDPServer) {
+	// If the following call panics, it indicates UnimplementedOpenSDPServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&OpenSDP_ServiceDesc, srv)
+}
+
+func _OpenSDP_Discover_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiscoverRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenSDPServer).Discover(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenSDP_Discover_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenSDPServer).Discover(ctx, req.(*DiscoverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenSDP_WatchServices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchServicesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OpenSDPServer).WatchServices(m, &grpc.GenericServerStream[WatchServicesRequest, DiscoverResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OpenSDP_WatchServicesServer = grpc.ServerStreamingServer[DiscoverResponse]
+
+func _OpenSDP_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenSDPServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenSDP_ReloadConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenSDPServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenSDP_ListServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenSDPServer).ListServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenSDP_ListServices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenSDPServer).ListServices(ctx, req.(*ListServicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenSDP_ListClients_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClientsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenSDPServer).ListClients(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenSDP_ListClients_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenSDPServer).ListClients(ctx, req.(*ListClientsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OpenSDP_ExplainPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExplainPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenSDPServer).ExplainPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OpenSDP_ExplainPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenSDPServer).ExplainPolicy(ctx, req.(*ExplainPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// OpenSDP_ServiceDesc is the grpc.ServiceDesc for OpenSDP service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OpenSDP_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opensdp.v1.OpenSDP",
+	HandlerType: (*OpenSDPServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Discover",
+			Handler:    _OpenSDP_Discover_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _OpenSDP_ReloadConfig_Handler,
+		},
+		{
+			MethodName: "ListServices",
+			Handler:    _OpenSDP_ListServices_Handler,
+		},
+		{
+			MethodName: "ListClients",
+			Handler:    _OpenSDP_ListClients_Handler,
+		},
+		{
+			MethodName: "ExplainPolicy",
+			Handler:    _OpenSDP_ExplainPolicy_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchServices",
+			Handler:       _OpenSDP_WatchServices_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "opensdp/v1/opensdp.proto",
+}
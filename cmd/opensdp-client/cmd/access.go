@@ -1,17 +1,32 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/greenstatic/opensdp/internal/client"
+	"github.com/greenstatic/opensdp/internal/hosts"
+	"github.com/greenstatic/opensdp/internal/probe"
 	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var (
-	all bool
+	all     bool
+	noWatch bool
+
+	noProbe       bool
+	probeTimeout  time.Duration
+	probeRetries  int
+	probeInterval time.Duration
 )
 
 var accessCmd = &cobra.Command{
@@ -27,69 +42,256 @@ var accessCmd = &cobra.Command{
 			return
 		}
 
-		openspaD := client.OpenSPADetails{
-			viper.GetString("openspa-path"),
-			viper.GetString("openspa-ospa"),
+		c := newClient(selectedProfile())
+		if !viper.GetBool("no-probe") {
+			c.Prober = newProber()
+			c.OnProbe = printProbeStatus
 		}
 
-		c := client.Client{
-			viper.GetString("server"),
-			viper.GetString("ca-cert"),
-			viper.GetString("certificate"),
-			viper.GetString("key"),
-			openspaD,
-		}
+		h := newHostsFile()
 
-		// Unlock the OpenSDP service using OpenSPA
-		openSdpUnlockUsingOpenSpa(c)
-		// OpenSDP server should be available now
+		if !noWatch {
+			failed, err := watchAccess(cmd.Context(), &c, h, args)
+			if err == nil {
+				cleanHosts(h)
+				os.Exit(accessExitStatus(failed))
+			}
+			if err == errUnknownService {
+				cleanHosts(h)
+				os.Exit(unknownService)
+			}
+			if err != client.ErrWatchUnsupported {
+				cleanHosts(h)
+				os.Exit(discoverFailed(err))
+			}
+			log.Info("Server does not support watching services, access is not updated on changes")
+		}
 
-		srvs, err := c.Discover()
+		srvs, err := c.Discover(cmd.Context())
 		if err != nil {
-			log.Error("Failed to perform discover exchange")
-			log.Error(err)
-			os.Exit(unexpectedError)
+			os.Exit(discoverFailed(err))
 		}
 
+		// Looked up before the hosts file is changed, so that exiting leaves it
+		// untouched
+		toAccess := srvs
+		if !all {
+			srv, ok := findService(srvs, args[0])
+			if !ok {
+				os.Exit(unknownService)
+			}
+			toAccess = []services.Service{srv}
+		}
+
+		updateHosts(h, srvs)
+
+		// Clean up the hosts file on exit
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			cleanHosts(h)
+			os.Exit(0)
+		}()
+
 		if all {
 			log.WithField("count", len(srvs)).Info("Gaining access to all authorized services")
-			client.ConcurrentAccessServiceContinuous(c, srvs)
-		} else {
-			srv := findService(srvs, args[0])
-			client.ConcurrentAccessServiceContinuous(c, []services.Service{srv})
 		}
+		failed := client.ConcurrentAccessServiceContinuous(c, toAccess)
+
+		cleanHosts(h)
+		os.Exit(accessExitStatus(failed))
 	},
 }
 
+// Interval of checking for ended sessions and services to retry while watching
+const sessionCheckInterval = 5 * time.Second
+
+// Keeps access to the services (all or the one named in args) while watching
+// the server for changes. Newly authorized services are accessed, access to
+// revoked ones is stopped and the hosts file is updated on each change. Ended
+// sessions are restarted and failed services retried with backoff. Returns
+// once ctx is done, or with the failed services once none of the services
+// could be accessed (as without watching). Returns errUnknownService
+// if the named service is not authorized when the watch starts.
+func watchAccess(ctx context.Context, c *client.Client, h *hosts.File, args []string) (map[string]error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sessions := c.NewSessionSet()
+	defer sessions.Stop()
+
+	// Serializes the updates of the watch and the session check, so that
+	// the latest wanted services are never replaced by earlier ones
+	var mu sync.Mutex
+	var wanted []services.Service
+	var failed map[string]error
+
+	// Updates the sessions to the wanted services, giving up once none of
+	// them could be accessed. Called holding mu.
+	update := func() {
+		if f := sessions.Update(wanted); len(f) > 0 && sessions.Running() == 0 {
+			failed = f
+			cancel()
+		}
+	}
+
+	// Sessions that have ended are restarted and failed services retried
+	// without waiting for the server to push a change
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+
+		t := time.NewTicker(sessionCheckInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			mu.Lock()
+			if wanted != nil && ctx.Err() == nil {
+				update()
+			}
+			mu.Unlock()
+		}
+	}()
+
+	var unknown bool
+	first := true
+	err := c.WatchServices(ctx, func(srvs []services.Service) {
+		log.WithField("count", len(srvs)).Info("Received authorized services")
+
+		if len(args) == 1 && first {
+			if _, ok := findService(srvs, args[0]); !ok {
+				unknown = true
+				cancel()
+				return
+			}
+		}
+		first = false
+
+		updateHosts(h, srvs)
+		if len(args) == 1 {
+			srvs = filterService(srvs, args[0])
+		}
+
+		mu.Lock()
+		wanted = append([]services.Service{}, srvs...)
+		update()
+		mu.Unlock()
+	})
+
+	// No sessions may be started once they are stopped
+	cancel()
+	<-checked
+
+	if unknown {
+		return nil, errUnknownService
+	}
+	return failed, err
+}
+
+// Returns the service with the name if it is in srvs
+func filterService(srvs []services.Service, name string) []services.Service {
+	for _, s := range srvs {
+		if s.Name == name {
+			return []services.Service{s}
+		}
+	}
+	return nil
+}
+
 func init() {
 	accessCmd.Flags().BoolVarP(&all, "all", "a", false, "Access all services you have access to")
+	accessCmd.Flags().BoolVar(&noWatch, "no-watch", false, "do not update access when the authorized services change")
+	addProbeFlags(accessCmd)
 
 	rootCmd.AddCommand(accessCmd)
 }
 
-// Finds the service by name from the slice of all services
-func findService(srvs []services.Service, name string) services.Service {
-	var serv services.Service
-	found := false
+// Returned by watchAccess when the service to access is not authorized
+var errUnknownService = errors.New("unknown service")
+
+// Finds the service by name from the slice of all services. Unknown services
+// are logged along with the authorized ones, the caller exits with
+// unknownService then.
+func findService(srvs []services.Service, name string) (services.Service, bool) {
 	for _, s := range srvs {
 		if s.Name == name {
-			serv = s
-			found = true
-			break
+			return s, true
 		}
 	}
 
-	if !found {
-		log.WithField("service", name).Warning("Unknown service")
+	log.WithField("service", name).Warning("Unknown service")
+
+	srvsName := make([]string, 0, len(srvs))
+	for _, s := range srvs {
+		srvsName = append(srvsName, s.Name)
+	}
+
+	log.WithField("services", strings.Join(srvsName, ", ")).Info("You have access to these services")
+	return services.Service{}, false
+}
+
+// Adds the flags that configure the post-access reachability probe. The flags
+// are bound to the config values only when the command runs, since several
+// commands share them.
+func addProbeFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noProbe, "no-probe", false, "do not probe services after gaining access")
+	cmd.Flags().DurationVar(&probeTimeout, "probe-timeout", 3*time.Second, "timeout of a single probe")
+	cmd.Flags().IntVar(&probeRetries, "probe-retries", 5, "probe retries before a service is unreachable")
+	cmd.Flags().DurationVar(&probeInterval, "probe-interval", time.Second, "delay between probe retries")
+
+	cmd.PreRun = func(cmd *cobra.Command, args []string) {
+		bindProbeFlags(cmd)
+	}
+}
+
+func bindProbeFlags(cmd *cobra.Command) {
+	viper.BindPFlag("no-probe", cmd.Flags().Lookup("no-probe"))
+	viper.BindPFlag("probe-timeout", cmd.Flags().Lookup("probe-timeout"))
+	viper.BindPFlag("probe-retries", cmd.Flags().Lookup("probe-retries"))
+	viper.BindPFlag("probe-interval", cmd.Flags().Lookup("probe-interval"))
+}
+
+func newProber() *probe.Prober {
+	return &probe.Prober{
+		Timeout:  viper.GetDuration("probe-timeout"),
+		Retries:  viper.GetInt("probe-retries"),
+		Interval: viper.GetDuration("probe-interval"),
+	}
+}
 
-		srvsName := make([]string, 0, len(srvs))
-		for _, s := range srvs {
-			srvsName = append(srvsName, s.Name)
+// Prints the probe status of each port of the service
+func printProbeStatus(srv services.Service, statuses []client.PortStatus) {
+	var b strings.Builder
+	for _, st := range statuses {
+		status := st.Result.String()
+		if st.Result == probe.Unreachable {
+			status = "access granted but unreachable"
 		}
+		fmt.Fprintf(&b, "|%-26s|%-18s|%-32s|\n", srv.Name, st.ProtoPort.String(), status)
+	}
+	fmt.Print(b.String())
+}
 
-		log.WithField("services", strings.Join(srvsName, ", ")).Info("You have access to these services")
-		os.Exit(unknownService)
+// Returns the exit status for the failed services of an access session.
+// Unreachable services take precedence over other failures.
+func accessExitStatus(failed map[string]error) int {
+	if len(failed) == 0 {
+		return 0
+	}
+
+	for _, err := range failed {
+		var unreachable *client.UnreachableError
+		if errors.As(err, &unreachable) {
+			return serviceUnreachable
+		}
 	}
 
-	return serv
+	return unexpectedError
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"github.com/greenstatic/opensdp/internal/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+)
+
+// Creates a client from the config values of the profile
+func newClient(profile string) client.Client {
+	openspaD := client.OpenSPADetails{
+		Path: profileString(profile, "openspa-path"),
+		OSPA: profileString(profile, "openspa-ospa"),
+	}
+
+	return client.Client{
+		Servers:       profileServers(profile),
+		ServerOrder:   profileString(profile, "server-order"),
+		ServerTimeout: viper.GetDuration(profileKey(profile, "server-timeout")),
+		Timeouts: client.Timeouts{
+			Dial:         viper.GetDuration(profileKey(profile, "dial-timeout")),
+			TLSHandshake: viper.GetDuration(profileKey(profile, "tls-timeout")),
+			Response:     viper.GetDuration(profileKey(profile, "response-timeout")),
+		},
+		Retries:          viper.GetInt(profileKey(profile, "retries")),
+		RetryBackoff:     viper.GetDuration(profileKey(profile, "retry-backoff")),
+		StatePath:        statePath(profile),
+		CAPath:           profileString(profile, "ca-cert"),
+		ServerName:       profileString(profile, "server-name"),
+		ServerPins:       viper.GetStringSlice(profileKey(profile, "server-pins")),
+		ClientCertPath:   certificatePath(profile),
+		ClientKeyPath:    profileString(profile, "key"),
+		ClientPKCS12Path: profileString(profile, "pkcs12"),
+		ClientPKCS11:     pkcs11Config(profile),
+		KeyPassphrase:    keyPassphrase(profile),
+		OpenSPA:          openspaD,
+
+		PostureCollectors: postureCollectors(profile),
+	}
+}
+
+// Returns the OpenSDP servers of the profile. The server value is tried
+// first, followed by the servers list.
+func profileServers(profile string) []string {
+	all := append([]string{profileString(profile, "server")},
+		viper.GetStringSlice(profileKey(profile, "servers"))...)
+
+	servers := make([]string, 0, len(all))
+	seen := make(map[string]bool)
+	for _, s := range all {
+		if s != "" && !seen[s] {
+			servers = append(servers, s)
+			seen[s] = true
+		}
+	}
+
+	return servers
+}
+
+// Returns the path of the file remembering the last working server of the
+// profile, or an empty string if it cannot be created.
+func statePath(profile string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		log.Debug("No cache dir to remember the last working server in")
+		return ""
+	}
+
+	dir = filepath.Join(dir, "opensdp")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.WithField("dir", dir).Debug("Failed to create cache dir")
+		return ""
+	}
+
+	name := "last-server"
+	if profile != "" {
+		name += "-" + profile
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var connectCmd = &cobra.Command{
+	Use:   "connect <service> -- <command> [args...]",
+	Short: "Runs a command once access to the service is gained",
+	Long: `Gains access to the service, waits until it is reachable and runs the command.
+Access to the service ends once the command exits, the client exits with the
+command's exit status (128 plus the signal's number if it was killed by a
+signal). The following placeholders in the command are replaced with the
+service's details:
+  {name}   service name
+  {ip}     service ip
+  {port}   first tcp/udp port of the service
+  {proto}  protocol of {port}
+  {ports}  all ports of the service, eg. 22/tcp,80/tcp
+  {tags}   service tags separated by commas
+
+Example: opensdp-client connect example-ssh -- ssh {ip} -p {port}`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if cmd.ArgsLenAtDash() != 1 {
+			log.Error("Expected the service name followed by -- and the command")
+			os.Exit(badInput)
+		}
+
+		c := newClient(selectedProfile())
+		if !viper.GetBool("no-probe") {
+			c.Prober = newProber()
+		}
+
+		srvs, err := c.Discover(cmd.Context())
+		if err != nil {
+			os.Exit(discoverFailed(err))
+		}
+
+		srv, ok := findService(srvs, args[0])
+		if !ok {
+			os.Exit(unknownService)
+		}
+
+		sess, err := c.StartAccess(srv)
+		if err != nil {
+			log.WithField("serviceName", srv.Name).Error("Failed to access service")
+			log.Error(err)
+			os.Exit(accessExitStatus(map[string]error{srv.Name: err}))
+		}
+
+		cmdArgs := make([]string, 0, len(args)-1)
+		for _, a := range args[1:] {
+			cmdArgs = append(cmdArgs, expandPlaceholders(a, srv))
+		}
+
+		log.WithField("command", strings.Join(cmdArgs, " ")).Debug("Running command")
+
+		status, err := runCommand(cmdArgs)
+		sess.Stop()
+		log.WithField("serviceName", srv.Name).Debug("Access session ended")
+
+		if err != nil {
+			log.Error("Failed to run command")
+			log.Error(err)
+			os.Exit(unexpectedError)
+		}
+
+		os.Exit(status)
+	},
+}
+
+func init() {
+	addProbeFlags(connectCmd)
+
+	rootCmd.AddCommand(connectCmd)
+}
+
+// Replaces the placeholders in s with the service's details
+func expandPlaceholders(s string, srv services.Service) string {
+	port, proto := "", ""
+	for _, pp := range srv.ProtoPort {
+		if pp.Protocol != services.ProtocolICMP {
+			port = strconv.Itoa(int(pp.Port))
+			proto = pp.Protocol.String()
+			break
+		}
+	}
+
+	r := strings.NewReplacer(
+		"{name}", srv.Name,
+		"{ip}", srv.IP.String(),
+		"{port}", port,
+		"{proto}", proto,
+		"{ports}", strings.Join(srv.ProtoPortToString(), ","),
+		"{tags}", strings.Join(srv.Tags, ","),
+	)
+
+	return r.Replace(s)
+}
+
+// Runs the command attached to our stdin, stdout and stderr and returns its
+// exit status, 128 plus the signal's number if it was killed by a signal.
+// Interrupts are left to the command (it receives them from the terminal as
+// well) so that we can end the access session after it exits.
+func runCommand(args []string) (int, error) {
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	// Catch (instead of ignore) the signals, since ignored signals would be
+	// inherited by the command
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	err := c.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Killed by a signal, exit with 128 plus its number as shells do
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
@@ -5,4 +5,8 @@ const (
 	unexpectedError
 	badInput
 	unknownService
+	serviceUnreachable
+	unauthorized
+	noServices
+	serverError
 )
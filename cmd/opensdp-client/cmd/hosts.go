@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/greenstatic/opensdp/internal/hosts"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Returns the hosts file managed by the client or nil if the hosts
+// integration is disabled.
+func newHostsFile() *hosts.File {
+	path := viper.GetString("hosts-file")
+	if path == "" {
+		return nil
+	}
+
+	return &hosts.File{Path: path, Domain: viper.GetString("hosts-domain")}
+}
+
+// Maps the services' names to their IPs in the managed hosts file
+func updateHosts(h *hosts.File, srvs []services.Service) {
+	if h == nil {
+		return
+	}
+
+	if err := h.Update(srvs); err != nil {
+		log.WithField("hosts", h.Path).Error("Failed to update hosts file")
+		log.Error(err)
+	}
+}
+
+// Removes the services from the managed hosts file
+func cleanHosts(h *hosts.File) {
+	if h == nil {
+		return
+	}
+
+	if err := h.Clean(); err != nil {
+		log.WithField("hosts", h.Path).Error("Failed to clean hosts file")
+		log.Error(err)
+	}
+}
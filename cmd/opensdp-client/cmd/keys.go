@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/greenstatic/opensdp/internal/keys"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// Environment variable holding the key passphrase unless key-passphrase-env
+// names another one
+const defaultPassphraseEnv = "OPENSDP_KEY_PASSPHRASE"
+
+// Returns the passphrase source of the profile's key: the key-passphrase-file,
+// the key-passphrase-env environment variable if set, otherwise a prompt on
+// the terminal.
+func keyPassphrase(profile string) keys.PassphraseFunc {
+	if path := profileString(profile, "key-passphrase-file"); path != "" {
+		return keys.PassphraseFromFile(path)
+	}
+
+	env := profileString(profile, "key-passphrase-env")
+	if env == "" {
+		env = defaultPassphraseEnv
+	}
+	if _, ok := os.LookupEnv(env); ok {
+		return keys.PassphraseFromEnv(env)
+	}
+
+	return keys.PassphrasePrompt("Client key passphrase: ")
+}
+
+// Returns the PKCS#11 token of the profile's key, nil if none is configured.
+func pkcs11Config(profile string) *keys.PKCS11Config {
+	module := profileString(profile, "pkcs11.module")
+	if module == "" {
+		return nil
+	}
+
+	return &keys.PKCS11Config{
+		Module:     module,
+		TokenLabel: profileString(profile, "pkcs11.token-label"),
+		KeyLabel:   profileString(profile, "pkcs11.key-label"),
+	}
+}
+
+// Returns the profile's certificate path. For keys on PKCS#11 tokens the
+// --certificate default is ignored, so that the certificate is read from the
+// token unless one is given on the command line or in the config.
+func certificatePath(profile string) string {
+	key := profileKey(profile, "certificate")
+	if pkcs11Config(profile) != nil && !rootCmd.PersistentFlags().Changed("certificate") && !viper.InConfig(key) {
+		return ""
+	}
+	return viper.GetString(key)
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/greenstatic/opensdp/internal/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var forwards []string
+
+var onDemandCmd = &cobra.Command{
+	Use:   "on-demand",
+	Short: "Listens locally and gains access to services on the first connection",
+	Long: `Exposes local loopback listeners for TCP services. On the first incoming connection
+the access handshake for the service is performed and the connection is forwarded
+to the service, eg. "-L 5432:example-db:5432" allows you to connect to localhost:5432.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(forwards) == 0 {
+			log.Error("Missing forward (eg. -L 2222:example-ssh:22)")
+			os.Exit(badInput)
+		}
+
+		specs := make([]forwardSpec, 0, len(forwards))
+		for _, f := range forwards {
+			spec, err := parseForward(f)
+			if err != nil {
+				log.WithField("forward", f).Error("Bad forward")
+				log.Error(err)
+				os.Exit(badInput)
+			}
+			specs = append(specs, spec)
+		}
+
+		c := newClient(selectedProfile())
+		if !viper.GetBool("no-probe") {
+			c.Prober = newProber()
+		}
+
+		srvs, err := c.Discover(cmd.Context())
+		if err != nil {
+			os.Exit(discoverFailed(err))
+		}
+
+		fwds := make([]*client.OnDemandForward, 0, len(specs))
+		for _, spec := range specs {
+			srv, ok := findService(srvs, spec.service)
+			if !ok {
+				os.Exit(unknownService)
+			}
+			fwd, err := c.NewOnDemandForward(spec.local, srv, spec.port)
+			if err != nil {
+				log.WithField("service", spec.service).Error(err)
+				os.Exit(badInput)
+			}
+			fwds = append(fwds, fwd)
+		}
+
+		h := newHostsFile()
+		updateHosts(h, srvs)
+
+		// Stop the access sessions on exit
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			log.Info("Shutting down")
+			for _, fwd := range fwds {
+				fwd.Close()
+			}
+		}()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, len(fwds))
+		for _, fwd := range fwds {
+			wg.Add(1)
+			go func(fwd *client.OnDemandForward) {
+				defer wg.Done()
+				if err := fwd.Serve(); err != nil {
+					log.WithField("local", fwd.Local).Error(err)
+					errs <- err
+					fwd.Close()
+				}
+			}(fwd)
+		}
+		wg.Wait()
+		cleanHosts(h)
+
+		if len(errs) > 0 {
+			os.Exit(unexpectedError)
+		}
+	},
+}
+
+func init() {
+	onDemandCmd.Flags().StringArrayVarP(&forwards, "forward", "L", nil,
+		"forward [bind:]localPort:service:remotePort, bind defaults to 127.0.0.1")
+	addProbeFlags(onDemandCmd)
+
+	rootCmd.AddCommand(onDemandCmd)
+}
+
+type forwardSpec struct {
+	local   string
+	service string
+	port    uint16
+}
+
+// Parses a forward in the form of [bind:]localPort:service:remotePort.
+// Only loopback bind addresses are allowed.
+func parseForward(s string) (forwardSpec, error) {
+	parts := strings.Split(s, ":")
+
+	bind := "127.0.0.1"
+	switch len(parts) {
+	case 3:
+	case 4:
+		bind, parts = parts[0], parts[1:]
+	default:
+		return forwardSpec{}, errors.New("expected [bind:]localPort:service:remotePort")
+	}
+
+	ip := net.ParseIP(bind)
+	if ip == nil || !ip.IsLoopback() {
+		return forwardSpec{}, errors.New("bind address must be a loopback ip")
+	}
+
+	if _, err := strconv.ParseUint(parts[0], 10, 16); err != nil {
+		return forwardSpec{}, errors.New("bad local port")
+	}
+
+	port, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return forwardSpec{}, errors.New("bad remote port")
+	}
+
+	return forwardSpec{
+		local:   net.JoinHostPort(bind, parts[0]),
+		service: parts[1],
+		port:    uint16(port),
+	}, nil
+}
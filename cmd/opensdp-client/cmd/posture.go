@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/greenstatic/opensdp/internal/posture"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+	"sort"
+)
+
+// Returns the posture collectors of the profile: the built-in collectors
+// listed in posture.collectors followed by the posture.commands, each
+// collecting a boolean fact using a shell command. Exits on unknown
+// collectors.
+func postureCollectors(profile string) []posture.Collector {
+	var collectors []posture.Collector
+	for _, name := range viper.GetStringSlice(profileKey(profile, "posture.collectors")) {
+		c, err := posture.Builtin(name, Version)
+		if err != nil {
+			log.Error("Bad posture collector")
+			log.Error(err)
+			os.Exit(badInput)
+		}
+		collectors = append(collectors, c)
+	}
+
+	commands := viper.GetStringMapString(profileKey(profile, "posture.commands"))
+	facts := make([]string, 0, len(commands))
+	for fact := range commands {
+		facts = append(facts, fact)
+	}
+	sort.Strings(facts)
+
+	for _, fact := range facts {
+		collectors = append(collectors, posture.CommandCollector{Fact: fact, Command: commands[fact]})
+	}
+
+	return collectors
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Returns the names of the profiles defined in the config, sorted.
+func profileNames() []string {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the profile to use: the one selected with --profile, otherwise the
+// default-profile from the config. When no profiles are defined an empty
+// string is returned, meaning the top-level config values are used.
+func selectedProfile() string {
+	names := profileNames()
+
+	name := profileName
+	if name == "" {
+		name = viper.GetString("default-profile")
+	}
+
+	if name == "" {
+		switch len(names) {
+		case 0:
+			return ""
+		case 1:
+			return names[0]
+		default:
+			log.WithField("profiles", strings.Join(names, ", ")).
+				Error("Multiple profiles configured, select one using --profile or set default-profile")
+			os.Exit(badInput)
+		}
+	}
+
+	// Viper lowercases the keys of the profiles map
+	name = strings.ToLower(name)
+
+	checkProfile(name)
+	return name
+}
+
+// Exits if the profile is not defined in the config
+func checkProfile(name string) {
+	for _, n := range profileNames() {
+		if n == name {
+			return
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"profile":  name,
+		"profiles": strings.Join(profileNames(), ", "),
+	}).Error("Unknown profile")
+	os.Exit(badInput)
+}
+
+// Returns the config key of the profile. Flags given on the command line take
+// precedence over the profile, while top-level config values are used as
+// defaults for all profiles.
+func profileKey(profile, key string) string {
+	if flag := rootCmd.PersistentFlags().Lookup(key); flag != nil && flag.Changed {
+		return key
+	}
+
+	if profile != "" {
+		pKey := "profiles." + profile + "." + key
+		if viper.IsSet(pKey) {
+			return pKey
+		}
+	}
+
+	return key
+}
+
+func profileString(profile, key string) string {
+	return viper.GetString(profileKey(profile, key))
+}
@@ -2,12 +2,17 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/greenstatic/opensdp/internal/client"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 )
 
 const defaultConfigFile = "config.yaml"
@@ -19,13 +24,30 @@ var (
 	ver          = false
 
 	serverUrl      string
+	serverOrder    string
+	serverTimeout  time.Duration
+	dialTimeout    time.Duration
+	tlsTimeout     time.Duration
+	respTimeout    time.Duration
+	retries        int
+	retryBackoff   time.Duration
 	caPath         string
+	serverName     string
+	serverPins     []string
 	clientCertPath string
 	clientKeyPath  string
 	cfgFile        string
+	profileName    string
 
 	openspaPath string
 	openspaOSPA string
+
+	hostsFile   string
+	hostsDomain string
+
+	clientPKCS12Path  string
+	keyPassphraseFile string
+	keyPassphraseEnv  string
 )
 
 var rootCmd = &cobra.Command{
@@ -45,31 +67,76 @@ to your authorized services.`,
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVarP(&serverUrl, "server", "s", "",
-		"OpenSDP server")
+		"OpenSDP server (additional servers to fail over to can be configured using servers)")
+	rootCmd.PersistentFlags().StringVar(&serverOrder, "server-order", client.ServerOrderSequential,
+		"order in which the servers are tried: sequential or random")
+	rootCmd.PersistentFlags().DurationVar(&serverTimeout, "server-timeout", 10*time.Second,
+		"timeout of a request to a single server, including retries")
+	rootCmd.PersistentFlags().DurationVar(&dialTimeout, "dial-timeout", 5*time.Second,
+		"timeout of connecting to the server")
+	rootCmd.PersistentFlags().DurationVar(&tlsTimeout, "tls-timeout", 5*time.Second,
+		"timeout of the TLS handshake with the server")
+	rootCmd.PersistentFlags().DurationVar(&respTimeout, "response-timeout", 5*time.Second,
+		"timeout of waiting for the server's response")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", 3,
+		"number of times a failed request to a server is retried")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", 500*time.Millisecond,
+		"delay before the first retry, doubled for every following retry")
 	rootCmd.PersistentFlags().StringVar(&caPath, "ca-cert", "", "certificate of the CA")
+	rootCmd.PersistentFlags().StringVar(&serverName, "server-name", client.DefaultServerName,
+		"name expected in the server's certificate")
+	rootCmd.PersistentFlags().StringSliceVar(&serverPins, "server-pins", nil,
+		"public key pins of the server (sha256/<base64 spki hash>), checked in addition to the CA or instead if no CA is set")
 	rootCmd.PersistentFlags().StringVarP(&clientCertPath, "certificate", "c", "client.crt",
-		"client's certificate")
+		"client's certificate (read from the token by default when using pkcs11)")
 	rootCmd.PersistentFlags().StringVarP(&clientKeyPath, "key", "k", "client.key",
 		"client's key")
+	rootCmd.PersistentFlags().StringVar(&clientPKCS12Path, "pkcs12", "",
+		"PKCS#12 bundle with the client's certificate and key, instead of --certificate and --key")
+	rootCmd.PersistentFlags().StringVar(&keyPassphraseFile, "key-passphrase-file", "",
+		"file containing the passphrase of the client's key (default: prompt)")
+	rootCmd.PersistentFlags().StringVar(&keyPassphraseEnv, "key-passphrase-env", defaultPassphraseEnv,
+		"environment variable containing the passphrase of the client's key")
 
 	rootCmd.PersistentFlags().StringVar(&openspaPath, "openspa-path", "openspa",
 		"OpenSPA path")
 	rootCmd.PersistentFlags().StringVar(&openspaOSPA, "openspa-ospa", "client.ospa",
 		"OpenSPA client OSPA file")
 
+	rootCmd.PersistentFlags().StringVar(&hostsFile, "hosts-file", "",
+		"hosts file to map <service>.<hosts-domain> to the service IP in (eg. /etc/hosts, default: disabled)")
+	rootCmd.PersistentFlags().StringVar(&hostsDomain, "hosts-domain", "opensdp",
+		"domain of the service names in the hosts file")
+
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "",
 		fmt.Sprintf("config file (default: ./%s)", defaultConfigFile))
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "P", "",
+		"profile from the config file to use (default: default-profile)")
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVar(&VerboseSplit, "verbose-split", false,
 		"split output to stdout (until but not including error level) and stderr (error level)")
 	rootCmd.Flags().BoolVar(&ver, "version", false, "version of the client")
 
 	viper.BindPFlag("ca-cert", rootCmd.PersistentFlags().Lookup("ca-cert"))
+	viper.BindPFlag("server-name", rootCmd.PersistentFlags().Lookup("server-name"))
+	viper.BindPFlag("server-pins", rootCmd.PersistentFlags().Lookup("server-pins"))
 	viper.BindPFlag("certificate", rootCmd.PersistentFlags().Lookup("certificate"))
 	viper.BindPFlag("key", rootCmd.PersistentFlags().Lookup("key"))
+	viper.BindPFlag("pkcs12", rootCmd.PersistentFlags().Lookup("pkcs12"))
+	viper.BindPFlag("key-passphrase-file", rootCmd.PersistentFlags().Lookup("key-passphrase-file"))
+	viper.BindPFlag("key-passphrase-env", rootCmd.PersistentFlags().Lookup("key-passphrase-env"))
 	viper.BindPFlag("server", rootCmd.PersistentFlags().Lookup("server"))
+	viper.BindPFlag("server-order", rootCmd.PersistentFlags().Lookup("server-order"))
+	viper.BindPFlag("server-timeout", rootCmd.PersistentFlags().Lookup("server-timeout"))
+	viper.BindPFlag("dial-timeout", rootCmd.PersistentFlags().Lookup("dial-timeout"))
+	viper.BindPFlag("tls-timeout", rootCmd.PersistentFlags().Lookup("tls-timeout"))
+	viper.BindPFlag("response-timeout", rootCmd.PersistentFlags().Lookup("response-timeout"))
+	viper.BindPFlag("retries", rootCmd.PersistentFlags().Lookup("retries"))
+	viper.BindPFlag("retry-backoff", rootCmd.PersistentFlags().Lookup("retry-backoff"))
 	viper.BindPFlag("openspa-path", rootCmd.PersistentFlags().Lookup("openspa-path"))
 	viper.BindPFlag("openspa-ospa", rootCmd.PersistentFlags().Lookup("openspa-ospa"))
+	viper.BindPFlag("hosts-file", rootCmd.PersistentFlags().Lookup("hosts-file"))
+	viper.BindPFlag("hosts-domain", rootCmd.PersistentFlags().Lookup("hosts-domain"))
 
 	log.SetOutput(os.Stdout)
 	cobra.OnInitialize(verboseSplit)
@@ -134,7 +201,15 @@ func verboseLog() {
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel in-flight requests on interrupt. Once cancelled, the default
+	// signal behaviour is restored.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(unexpectedError)
 	}
@@ -1,15 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/greenstatic/opensdp/internal/client"
 	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"net"
 	"os"
-	"strconv"
 	"strings"
 )
 
@@ -20,40 +18,61 @@ var servicesCmd = &cobra.Command{
 
 	Run: func(cmd *cobra.Command, args []string) {
 
-		openspaD := client.OpenSPADetails{
-			viper.GetString("openspa-path"),
-			viper.GetString("openspa-ospa"),
+		// List the services of all profiles unless one was selected
+		profiles := profileNames()
+		if profileName != "" || len(profiles) == 0 {
+			profiles = []string{selectedProfile()}
 		}
 
-		c := client.Client{
-			viper.GetString("server"),
-			viper.GetString("ca-cert"),
-			viper.GetString("certificate"),
-			viper.GetString("key"),
-			openspaD,
+		type profileService struct {
+			profile string
+			services.Service
 		}
 
-		// Unlock the OpenSDP service using OpenSPA
-		openSdpUnlockUsingOpenSpa(c)
-		// OpenSDP server should be available now
-
-		// Perform the services lookup
-		srvs, err := c.Discover()
-		if err != nil {
-			log.Error("Failed to perform discover exchange")
-			log.Error(err)
-			os.Exit(unexpectedError)
+		srvs := make([]profileService, 0)
+		status := 0
+		for _, profile := range profiles {
+			c := newClient(profile)
+
+			// Perform the services lookup
+			pSrvs, err := c.Discover(cmd.Context())
+			if errors.Is(err, client.ErrNoServices) {
+				continue
+			}
+			if err != nil {
+				if profile != "" {
+					log.WithField("profile", profile).Error("Failed to list the profile's services")
+				}
+				status = discoverFailed(err)
+				continue
+			}
+
+			for _, s := range pSrvs {
+				srvs = append(srvs, profileService{profile, s})
+			}
 		}
 
 		if len(srvs) == 0 {
+			if status != 0 {
+				os.Exit(status)
+			}
 			fmt.Println("You do not have access to any services")
-			return
+			os.Exit(noServices)
 		}
 
+		// Show the profile column only when profiles are configured
+		showProfile := profiles[0] != ""
+
 		fmt.Println("You have access to the following services:")
+		if showProfile {
+			fmt.Printf("|%-12s", "Profile")
+		}
 		fmt.Printf("|%-26s|%-26s|%-18s|%-12s|%-20s|\n", "Name", "IP", "Port(s)", "Access Type", "Tag(s)")
 
-		const dashLen = 108
+		dashLen := 108
+		if showProfile {
+			dashLen += 13
+		}
 		for i := 0; i < dashLen; i++ {
 			fmt.Printf("-")
 		}
@@ -63,9 +82,13 @@ var servicesCmd = &cobra.Command{
 			ports := strings.Join(s.ProtoPortToString(), ", ")
 			accessTypes := strings.Join(s.AccessTypeToString(), ", ")
 			tags := strings.Join(s.Tags, ", ")
+			if showProfile {
+				fmt.Printf("|%-12s", s.profile)
+			}
 			fmt.Printf("|%-26s|%-26s|%-18s|%-12s|%-20s|\n", s.Name, s.IP.String(), ports, accessTypes, tags)
 		}
 
+		os.Exit(status)
 	},
 }
 
@@ -73,33 +96,19 @@ func init() {
 	rootCmd.AddCommand(servicesCmd)
 }
 
-func openSdpUnlockUsingOpenSpa(c client.Client) {
-	// Parse the OpenSDP server IP and port
-	opensdpIp, opensdpPortStr, err := net.SplitHostPort(c.Server)
-	if err != nil {
-		log.Error("Failed to parse the server field into host and port")
-		log.Error(err)
-		os.Exit(badInput)
-	}
-
-	opensdpPortInt, err := strconv.Atoi(opensdpPortStr)
-	if err != nil {
-		log.Error("Failed to parse the server port field into an integer")
-		log.Error(err)
-		os.Exit(badInput)
-	}
-
-	// Create pseudo OpenSDP service
-	opensdpService := services.Service{
-		IP:        net.ParseIP(opensdpIp),
-		ProtoPort: []services.ProtoPort{{Protocol: services.ProtocolTCP, Port: uint16(opensdpPortInt)}},
-	}
-
-	// Using OpenSPA request access to the OpenSDP server
-	err = client.AccessOpenSPAService(opensdpService, false, c.OpenSPA.Path, c.OpenSPA.OSPA)
-	if err != nil {
-		log.Error("Failed to unlock the OpenSDP service port using OpenSPA")
-		log.Error(err)
-		os.Exit(unexpectedError)
+// Logs the discover exchange error and returns the exit status for it
+func discoverFailed(err error) int {
+	log.Error("Failed to perform discover exchange")
+	log.Error(err)
+
+	switch {
+	case errors.Is(err, client.ErrUnauthorized):
+		return unauthorized
+	case errors.Is(err, client.ErrNoServices):
+		return noServices
+	case errors.Is(err, client.ErrServerError):
+		return serverError
+	default:
+		return unexpectedError
 	}
 }
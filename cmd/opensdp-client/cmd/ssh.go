@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/openspa"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var sshUser string
+
+var sshProxyCmd = &cobra.Command{
+	Use:   "ssh-proxy <service> <port>",
+	Short: "Gains access to the service and pipes stdin/stdout to it (SSH ProxyCommand)",
+	Long: `Gains access to the service port and pipes stdin/stdout to the TCP connection.
+Intended to be used as an SSH ProxyCommand, see the ssh-config command.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// stdout is the data channel
+		log.SetOutput(os.Stderr)
+		openspa.Output = os.Stderr
+
+		port, err := strconv.ParseUint(args[1], 10, 16)
+		if err != nil {
+			log.WithField("port", args[1]).Error("Bad port")
+			os.Exit(badInput)
+		}
+
+		c := newClient(selectedProfile())
+		if !viper.GetBool("no-probe") {
+			c.Prober = newProber()
+		}
+
+		srvs, err := c.Discover(cmd.Context())
+		if err != nil {
+			os.Exit(discoverFailed(err))
+		}
+
+		srv, ok := findService(srvs, args[0])
+		if !ok {
+			os.Exit(unknownService)
+		}
+
+		// Only access the port we are proxying to
+		pp := services.ProtoPort{Protocol: services.ProtocolTCP, Port: uint16(port)}
+		if !hasProtoPort(srv, pp) {
+			log.WithFields(log.Fields{"service": srv.Name, "port": pp.String()}).Error("Service does not expose port")
+			os.Exit(badInput)
+		}
+		srv.ProtoPort = []services.ProtoPort{pp}
+
+		sess, err := c.StartAccess(srv)
+		if err != nil {
+			log.WithField("serviceName", srv.Name).Error("Failed to access service")
+			log.Error(err)
+			os.Exit(accessExitStatus(map[string]error{srv.Name: err}))
+		}
+
+		conn, err := net.Dial("tcp", net.JoinHostPort(srv.IP.String(), args[1]))
+		if err != nil {
+			sess.Stop()
+			log.WithField("serviceName", srv.Name).Error("Failed to connect to service")
+			log.Error(err)
+			os.Exit(serviceUnreachable)
+		}
+
+		go func() {
+			io.Copy(conn, os.Stdin)
+			conn.(*net.TCPConn).CloseWrite()
+		}()
+		io.Copy(os.Stdout, conn)
+
+		conn.Close()
+		sess.Stop()
+	},
+}
+
+var sshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Prints ~/.ssh/config Host blocks for authorized SSH services",
+	Long: `Prints ~/.ssh/config Host blocks for every authorized service that exposes port
+22/tcp or is tagged ssh. The blocks use ssh-proxy as the ProxyCommand, allowing
+you to simply run: ssh <service>`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := selectedProfile()
+		c := newClient(profile)
+
+		srvs, err := c.Discover(cmd.Context())
+		if err != nil {
+			os.Exit(discoverFailed(err))
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			log.Error("Failed to find the client's executable")
+			log.Error(err)
+			os.Exit(unexpectedError)
+		}
+
+		proxyCmd := []string{proxyCommandArg(exe)}
+		if cfg := viper.ConfigFileUsed(); cfg != "" {
+			if abs, err := filepath.Abs(cfg); err == nil {
+				cfg = abs
+			}
+			proxyCmd = append(proxyCmd, "--config", proxyCommandArg(cfg))
+		}
+		if profile != "" {
+			proxyCmd = append(proxyCmd, "--profile", proxyCommandArg(profile))
+		}
+		proxyCmd = append(proxyCmd, "ssh-proxy", "%n", "%p")
+
+		for _, srv := range srvs {
+			port, ok := sshPort(srv)
+			if !ok {
+				continue
+			}
+
+			fmt.Printf("Host %s\n", srv.Name)
+			fmt.Printf("  HostName %s\n", srv.IP.String())
+			fmt.Printf("  Port %d\n", port)
+			if sshUser != "" {
+				fmt.Printf("  User %s\n", sshUser)
+			}
+			// ssh expands %n to the host as given on the command line (the service name)
+			fmt.Printf("  ProxyCommand %s\n\n", strings.Join(proxyCmd, " "))
+		}
+	},
+}
+
+// Quotes the argument for the shell ssh runs the ProxyCommand with and escapes
+// the % ssh would expand
+func proxyCommandArg(arg string) string {
+	arg = strings.Replace(arg, "%", "%%", -1)
+
+	safe := arg != ""
+	for _, r := range arg {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-+=:,@%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func init() {
+	addProbeFlags(sshProxyCmd)
+	sshConfigCmd.Flags().StringVarP(&sshUser, "user", "u", "", "User to add to the Host blocks")
+
+	rootCmd.AddCommand(sshProxyCmd)
+	rootCmd.AddCommand(sshConfigCmd)
+}
+
+func hasProtoPort(srv services.Service, pp services.ProtoPort) bool {
+	for _, p := range srv.ProtoPort {
+		if p == pp {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the SSH port of the service. Port 22/tcp is preferred, otherwise the
+// first tcp port of services tagged ssh is used.
+func sshPort(srv services.Service) (uint16, bool) {
+	if hasProtoPort(srv, services.ProtoPort{Protocol: services.ProtocolTCP, Port: 22}) {
+		return 22, true
+	}
+
+	tagged := false
+	for _, t := range srv.Tags {
+		if strings.EqualFold(t, "ssh") {
+			tagged = true
+			break
+		}
+	}
+	if !tagged {
+		return 0, false
+	}
+
+	for _, pp := range srv.ProtoPort {
+		if pp.Protocol == services.ProtocolTCP {
+			return pp.Port, true
+		}
+	}
+
+	return 0, false
+}
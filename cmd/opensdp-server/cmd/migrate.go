@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/configsyaml"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+)
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate-config [file...]",
+	Short: "Upgrades the services and clients files to the current schema version",
+	Long: `Upgrades the services and clients files (by default the configured ones) to
+the current schema version. The files are rewritten in place, keeping a copy
+of the original with the old version appended to its name (eg.
+services.yaml.0.1.0, numbered if it exists). Files with unknown fields are not upgraded, they have to
+be fixed first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		files := args
+		if len(files) == 0 {
+			files = []string{viper.GetString("services"), viper.GetString("clients")}
+		}
+
+		failed := false
+		for _, f := range files {
+			if err := migrateFile(f); err != nil {
+				failed = true
+			}
+		}
+
+		if failed {
+			os.Exit(badInput)
+		}
+	},
+}
+
+func migrateFile(path string) error {
+	data, from, err := configsyaml.Migrate(path)
+	if err != nil {
+		if unknown, ok := err.(*configsyaml.UnknownFieldsError); ok {
+			for _, p := range unknown.Problems {
+				fmt.Println(p)
+			}
+		}
+		log.WithField("file", path).Error("Failed to upgrade file")
+		log.Error(err)
+		return err
+	}
+
+	fields := log.Fields{"file": path, "from": from, "to": configsyaml.SchemaVersion}
+	if from == configsyaml.SchemaVersion {
+		log.WithField("file", path).Info("File already has the current schema version")
+		return nil
+	}
+	if migrateDryRun {
+		log.WithFields(fields).Info("File would be upgraded")
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.WithField("file", path).Error("Failed to upgrade file")
+		log.Error(err)
+		return err
+	}
+
+	backup, err := configsyaml.Backup(path, from, info.Mode())
+	if err != nil {
+		log.WithField("file", path).Error("Failed to back up file")
+		log.Error(err)
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, info.Mode()); err != nil {
+		log.WithField("file", path).Error("Failed to write upgraded file, the original is kept as " + backup)
+		log.Error(err)
+		return err
+	}
+
+	log.WithFields(fields).WithField("backup", backup).Info("Upgraded file")
+	return nil
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "only report the files that would be upgraded")
+
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/greenstatic/opensdp/internal/server"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Prints the OpenAPI document of the server's API",
+	Long: `Prints the OpenAPI document of the server's API, which is also served at
+/openapi.json.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Stdout.Write(server.OpenAPIDocument)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/server"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+var (
+	explainIP      string
+	explainTime    string
+	explainPosture map[string]string
+	explainCert    string
+	explainJSON    bool
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Inspects the policy of the services and clients files",
+}
+
+var policyExplainCmd = &cobra.Command{
+	Use:   "explain <device-id>",
+	Short: "Explains why each service is given to or withheld from a device",
+	Long: `Evaluates the services and clients files for the device and prints every
+service, whether it is allowed or denied and the policy rules that decided it.
+The attributes of the discover request can be simulated using the flags,
+without them the current time is used and the device has no peer address,
+certificate or posture facts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		identity := identityConfig()
+		if err := identity.Validate(); err != nil {
+			log.Error("Invalid identity config")
+			log.Error(err)
+			os.Exit(badInput)
+		}
+
+		deviceId, err := identity.ParseDeviceId(args[0])
+		if err != nil {
+			log.Error("Invalid device id")
+			log.Error(err)
+			os.Exit(badInput)
+		}
+
+		q, err := policyQuery(deviceId)
+		if err != nil {
+			log.Error(err)
+			os.Exit(badInput)
+		}
+
+		srvs, clnts, err := readConfigs()
+		if err != nil {
+			os.Exit(unexpectedError)
+		}
+
+		s := &server.Server{Services: srvs, Clients: clnts, Identity: identity}
+		exp, err := s.ExplainPolicy(q)
+		if err != nil {
+			log.WithField("deviceId", deviceId).Error("Failed to explain policy")
+			log.Error(err)
+			os.Exit(badInput)
+		}
+
+		if explainJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			enc.Encode(exp)
+			return
+		}
+		printExplanation(exp)
+	},
+}
+
+// Returns the simulated request given by the flags
+func policyQuery(deviceId string) (server.PolicyQuery, error) {
+	q := server.PolicyQuery{DeviceId: deviceId, PeerIP: explainIP, Posture: posture.Facts(explainPosture)}
+
+	if explainTime != "" {
+		t, err := parseExplainTime(explainTime)
+		if err != nil {
+			return server.PolicyQuery{}, err
+		}
+		q.Time = t
+	}
+
+	if explainCert != "" {
+		cert, err := readCertificate(explainCert)
+		if err != nil {
+			return server.PolicyQuery{}, err
+		}
+		q.Cert = cert
+	}
+
+	return q, nil
+}
+
+// Parses an RFC 3339 time or a time of today (eg. 18:30) in local time
+func parseExplainTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Local(), nil
+	}
+
+	t, err := time.ParseInLocation("15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %s, expected RFC 3339 (eg. 2006-01-02T15:04:05Z) or 15:04", s)
+	}
+
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+}
+
+// Reads the first certificate of the PEM file
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate in " + path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func printExplanation(exp server.PolicyExplanation) {
+	fmt.Printf("Device %s\n", exp.DeviceId)
+
+	for _, se := range exp.Services {
+		decision := "deny"
+		if se.Allowed {
+			decision = "allow"
+		}
+		fmt.Printf("\n%s: %s (%s)\n", se.Service, decision, se.Reason)
+
+		for i, re := range se.Rules {
+			result := "no match"
+			switch {
+			case re.Error != "":
+				result = "error: " + re.Error
+			case re.Matched:
+				result = "match"
+			}
+			fmt.Printf("  %d. %s => %s\n", i+1, re.Rule, result)
+		}
+
+		for _, f := range se.PostureFailures {
+			actual := f.Actual
+			if actual == "" {
+				actual = "not submitted"
+			}
+			fmt.Printf("  posture %s %s => %s\n", f.Fact, f.Requirement, actual)
+		}
+	}
+}
+
+func init() {
+	policyExplainCmd.Flags().StringVar(&explainIP, "ip", "", "simulated peer ip of the device")
+	policyExplainCmd.Flags().StringVar(&explainTime, "time", "",
+		"simulated time, RFC 3339 or 15:04 (default: now)")
+	policyExplainCmd.Flags().StringToStringVar(&explainPosture, "posture", nil,
+		"simulated posture facts, eg. disk-encryption=true,os-version=22.04")
+	policyExplainCmd.Flags().StringVar(&explainCert, "cert", "", "client certificate of the device (PEM)")
+	policyExplainCmd.Flags().BoolVar(&explainJSON, "json", false, "print the explanation as JSON")
+
+	policyCmd.AddCommand(policyExplainCmd)
+	rootCmd.AddCommand(policyCmd)
+}
@@ -3,15 +3,17 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"github.com/greenstatic/opensdp/internal/server"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var (
-	Version      = "0.1.0"
+	Version      = "0.2.0"
 	Verbose      = false
 	VerboseSplit = false
 	ver          = false
@@ -24,6 +26,12 @@ var (
 	serverKeyPath  string
 	bind           string
 	port           uint16
+	grpcPort       uint16
+
+	shutdownTimeout time.Duration
+	postureMaxAge   time.Duration
+	tlsProfile      string
+	tlsMinVersion   string
 )
 
 var rootCmd = &cobra.Command{
@@ -63,10 +71,20 @@ func init() {
 	rootCmd.Flags().StringVarP(&bind, "bind", "b", "0.0.0.0",
 		"bind server to IP")
 	rootCmd.Flags().Uint16VarP(&port, "port", "p", 8443, "port to listen to")
-
-	rootCmd.Flags().StringVar(&cfgFile, "config", "", "config file (default: ./config.yaml)")
-	rootCmd.Flags().StringVar(&servicesPath, "services", "", "services file (default: ./services.yaml)")
-	rootCmd.Flags().StringVar(&clientsPath, "clients", "", "clients file (default: ./clients.yaml)")
+	rootCmd.Flags().Uint16Var(&grpcPort, "grpc-port", 0, "port of the gRPC API (default: disabled)")
+	rootCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"time to drain in-flight requests on shutdown")
+	rootCmd.Flags().DurationVar(&postureMaxAge, "posture-max-age", 5*time.Minute,
+		"end watches after this time, so that clients submit fresh posture (0: never)")
+	rootCmd.Flags().StringVar(&tlsProfile, "tls-profile", server.TLSProfileIntermediate,
+		"TLS profile, modern (TLS 1.3 only) or intermediate")
+	rootCmd.Flags().StringVar(&tlsMinVersion, "tls-min-version", "",
+		"minimum TLS version, 1.2 or 1.3 (default: the profile's)")
+
+	// Persistent, since subcommands read the config as well
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default: ./config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&servicesPath, "services", "", "services file (default: ./services.yaml)")
+	rootCmd.PersistentFlags().StringVar(&clientsPath, "clients", "", "clients file (default: ./clients.yaml)")
 
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false,
 		"verbose output")
@@ -79,8 +97,13 @@ func init() {
 	viper.BindPFlag("key", rootCmd.Flags().Lookup("key"))
 	viper.BindPFlag("bind", rootCmd.Flags().Lookup("bind"))
 	viper.BindPFlag("port", rootCmd.Flags().Lookup("port"))
-	viper.BindPFlag("clients", rootCmd.Flags().Lookup("clients"))
-	viper.BindPFlag("services", rootCmd.Flags().Lookup("services"))
+	viper.BindPFlag("grpc-port", rootCmd.Flags().Lookup("grpc-port"))
+	viper.BindPFlag("shutdown-timeout", rootCmd.Flags().Lookup("shutdown-timeout"))
+	viper.BindPFlag("posture-max-age", rootCmd.Flags().Lookup("posture-max-age"))
+	viper.BindPFlag("tls.profile", rootCmd.Flags().Lookup("tls-profile"))
+	viper.BindPFlag("tls.min-version", rootCmd.Flags().Lookup("tls-min-version"))
+	viper.BindPFlag("clients", rootCmd.PersistentFlags().Lookup("clients"))
+	viper.BindPFlag("services", rootCmd.PersistentFlags().Lookup("services"))
 
 	log.SetOutput(os.Stdout)
 	cobra.OnInitialize(verboseSplit)
@@ -104,6 +127,12 @@ func initConfig() {
 	}
 
 	if err := viper.ReadInConfig(); err != nil {
+		// Without a config file given, the values may come from flags alone
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok && cfgFile == "" {
+			log.Debug("No config file found")
+			return
+		}
+
 		log.Error("failed to read config")
 		log.Error(err)
 		os.Exit(unexpectedError)
@@ -1,42 +1,196 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/clients"
 	"github.com/greenstatic/opensdp/internal/configsyaml"
 	"github.com/greenstatic/opensdp/internal/server"
+	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 )
 
 func startServer() {
 	portStr := strconv.Itoa(int(viper.GetInt("port")))
 
-	servicesPath := viper.GetString("services")
-	srvs, err := configsyaml.ServicesRead(servicesPath)
+	if err := identityConfig().Validate(); err != nil {
+		log.Error("Invalid identity config")
+		log.Error(err)
+		os.Exit(badInput)
+	}
+
+	admins, err := adminsConfig()
 	if err != nil {
-		log.WithField("services", servicesPath).Error("Failed to read services")
+		log.Error("Invalid admins")
+		log.Error(err)
+		os.Exit(badInput)
+	}
+
+	srvs, clnts, err := readConfigs()
+	if err != nil {
+		os.Exit(unexpectedError)
+	}
+
+	grpcPortStr := ""
+	if grpcPort := viper.GetInt("grpc-port"); grpcPort != 0 {
+		grpcPortStr = strconv.Itoa(grpcPort)
+	}
+
+	s := &server.Server{
+		CAPath:         viper.GetString("ca-cert"),
+		ServerCertPath: viper.GetString("certificate"),
+		ServerKeyPath:  viper.GetString("key"),
+		Bind:           viper.GetString("bind"),
+		Port:           portStr,
+		GRPCPort:       grpcPortStr,
+		Services:       srvs,
+		Clients:        clnts,
+		Admins:         admins,
+		Identity:       identityConfig(),
+		Reload:         readConfigs,
+		TLSPolicy:      tlsPolicyConfig(),
+		PostureMaxAge:  viper.GetDuration("posture-max-age"),
+	}
+
+	// Closed once the server has shut down
+	done := make(chan struct{})
+
+	// Reload the services, clients and certificates on SIGHUP, hand off the listeners to a
+	// new process on SIGUSR2 and shut down gracefully on SIGINT and SIGTERM
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGUSR2, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sg := range sig {
+			switch sg {
+			case syscall.SIGHUP:
+				log.Info("Reloading services and clients")
+				if err := s.ReloadConfig(); err != nil {
+					log.Error("Failed to reload, keeping the previous services and clients")
+				}
+				if err := s.ReloadCertificates(); err != nil {
+					log.Error("Failed to reload certificates, keeping the current ones")
+					log.Error(err)
+				}
+
+			case syscall.SIGUSR2:
+				log.Info("Handing off the listeners to a new server process")
+				if err := s.Handoff(); err != nil {
+					log.Error("Failed to hand off the listeners, continuing to serve")
+					log.Error(err)
+					continue
+				}
+				shutdown(s, done)
+				return
+
+			default:
+				shutdown(s, done)
+				return
+			}
+		}
+	}()
+
+	if err := s.Start(); err != nil {
+		log.Error("Server failed")
 		log.Error(err)
 		os.Exit(unexpectedError)
 	}
 
+	// Start returns as soon as the shutdown begins
+	<-done
+}
+
+// Shuts the server down, draining in-flight requests for at most the
+// shutdown-timeout. Closes done afterwards.
+func shutdown(s *server.Server, done chan struct{}) {
+	timeout := viper.GetDuration("shutdown-timeout")
+	log.WithField("timeout", timeout.String()).Info("Shutting down, draining in-flight requests")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		log.Error("Failed to drain in-flight requests")
+		log.Error(err)
+	}
+
+	log.Info("Server stopped")
+	close(done)
+}
+
+// Returns how device IDs are extracted from client certificates
+func identityConfig() server.Identity {
+	return server.Identity{
+		Source: viper.GetString("identity.source"),
+		Prefix: viper.GetString("identity.prefix"),
+	}
+}
+
+// Returns the device IDs of the admins in the form extracted from
+// certificates, eg. fingerprints as lowercase hex without colons
+func adminsConfig() ([]string, error) {
+	identity := identityConfig()
+
+	var admins []string
+	for i, id := range viper.GetStringSlice("admins") {
+		deviceId, err := identity.ParseDeviceId(id)
+		if err != nil {
+			return nil, fmt.Errorf("admins[%d]: %s", i, err)
+		}
+		admins = append(admins, deviceId)
+	}
+	return admins, nil
+}
+
+// Returns the TLS policy of the HTTPS and gRPC APIs
+func tlsPolicyConfig() server.TLSPolicy {
+	return server.TLSPolicy{
+		Profile:      viper.GetString("tls.profile"),
+		MinVersion:   viper.GetString("tls.min-version"),
+		CipherSuites: viper.GetStringSlice("tls.cipher-suites"),
+		Curves:       viper.GetStringSlice("tls.curves"),
+		DisableHTTP2: viper.GetBool("tls.disable-http2"),
+	}
+}
+
+// Reads the services and clients files. The files are validated first, so
+// that the server refuses the same problems validate reports.
+func readConfigs() ([]services.Service, map[string]clients.Client, error) {
+	servicesPath := viper.GetString("services")
 	clientsPath := viper.GetString("clients")
-	clnts, err := configsyaml.ClientsRead(clientsPath, srvs)
+
+	errs := 0
+	for _, p := range configsyaml.Validate(servicesPath, clientsPath, identityConfig().ParseDeviceId) {
+		if p.Warning {
+			log.Warning(p)
+			continue
+		}
+		log.Error(p)
+		errs++
+	}
+	if errs > 0 {
+		log.WithField("errors", errs).Error("Invalid services or clients, check them using validate")
+		return nil, nil, errors.New("invalid services or clients")
+	}
+
+	srvs, err := configsyaml.ServicesRead(servicesPath)
 	if err != nil {
-		log.WithField("clients", clientsPath).Error("Failed to read clients")
+		log.WithField("services", servicesPath).Error("Failed to read services")
 		log.Error(err)
-		os.Exit(unexpectedError)
+		return nil, nil, err
 	}
 
-	s := server.Server{
-		viper.GetString("ca-cert"),
-		viper.GetString("certificate"),
-		viper.GetString("key"),
-		viper.GetString("bind"),
-		portStr,
-		srvs,
-		clnts,
+	clnts, err := configsyaml.ClientsRead(clientsPath, srvs, identityConfig().ParseDeviceId)
+	if err != nil {
+		log.WithField("clients", clientsPath).Error("Failed to read clients")
+		log.Error(err)
+		return nil, nil, err
 	}
 
-	s.Start()
+	return srvs, clnts, nil
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/configsyaml"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+var validateStrict bool
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the server config, services and clients files",
+	Long: `Checks the server config, services and clients files and reports every
+problem found with its file, line and path (eg. clients[3].services[1].name).
+Besides invalid values it reports unknown fields, duplicate service names and
+device IDs and, as warnings, services not given to any device. Exits with a
+non-zero status if errors are found, or warnings using --strict (for use in
+CI).`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		identity := identityConfig()
+
+		var problems []configsyaml.Problem
+		identityErr := identity.Validate()
+		if identityErr != nil {
+			problems = append(problems, configProblem("identity", identityErr))
+		} else if _, err := adminsConfig(); err != nil {
+			problems = append(problems, configProblem("admins", err))
+		}
+		if err := tlsPolicyConfig().Apply(&tls.Config{}); err != nil {
+			problems = append(problems, configProblem("tls", err))
+		}
+
+		parseDeviceId := identity.ParseDeviceId
+		if identityErr != nil {
+			// Device IDs cannot be checked using an invalid identity config
+			parseDeviceId = func(id string) (string, error) { return id, nil }
+		}
+		problems = append(problems,
+			configsyaml.Validate(viper.GetString("services"), viper.GetString("clients"), parseDeviceId)...)
+
+		errs, warnings := 0, 0
+		for _, p := range problems {
+			fmt.Println(p)
+			if p.Warning {
+				warnings++
+			} else {
+				errs++
+			}
+		}
+
+		fields := log.Fields{"errors": errs, "warnings": warnings}
+		if errs > 0 || (validateStrict && warnings > 0) {
+			log.WithFields(fields).Error("Invalid config")
+			os.Exit(badInput)
+		}
+		log.WithFields(fields).Info("Config is valid")
+	},
+}
+
+// Returns the problem of a server config value
+func configProblem(path string, err error) configsyaml.Problem {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		file = "flags"
+	}
+	return configsyaml.Problem{File: file, Path: path, Msg: err.Error()}
+}
+
+func init() {
+	validateCmd.Flags().BoolVar(&validateStrict, "strict", false, "fail on warnings as well")
+
+	rootCmd.AddCommand(validateCmd)
+}
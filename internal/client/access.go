@@ -2,25 +2,166 @@ package client
 
 import (
 	"errors"
+	"fmt"
 	"github.com/greenstatic/opensdp/internal/openspa"
+	"github.com/greenstatic/opensdp/internal/probe"
 	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
+	"os/exec"
+	"strings"
 	"time"
 )
 
+// Returned when the access handshake succeeded but probing the service
+// afterwards failed for at least one of its ports.
+type UnreachableError struct {
+	Service string
+	Ports   []services.ProtoPort
+}
+
+func (e *UnreachableError) Error() string {
+	ports := make([]string, 0, len(e.Ports))
+	for _, p := range e.Ports {
+		ports = append(ports, p.String())
+	}
+	return fmt.Sprintf("access granted but service %s unreachable on %s", e.Service, strings.Join(ports, ", "))
+}
+
+// Probe result of a single service port
+type PortStatus struct {
+	ProtoPort services.ProtoPort
+	Result    probe.Result
+	Err       error
+}
+
+// Access sessions keep the OpenSPA clients for all ports of a service running.
+type Session struct {
+	Service services.Service
+	cmds    []*exec.Cmd
+	done    chan struct{}
+	err     error
+}
+
+// Waits for all OpenSPA clients of the session and records the first error.
+func (s *Session) wait() {
+	for _, cmd := range s.cmds {
+		if err := cmd.Wait(); err != nil && s.err == nil {
+			s.err = err
+		}
+	}
+	close(s.done)
+}
+
+// Waits for all OpenSPA clients of the session to exit. Returns the first error.
+func (s *Session) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Closed once all OpenSPA clients of the session have exited.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Kills all OpenSPA clients of the session and waits for them to exit.
+func (s *Session) Stop() {
+	for _, cmd := range s.cmds {
+		cmd.Process.Kill()
+	}
+	<-s.done
+}
+
 func (c *Client) Access(serv services.Service) error {
+	sess, err := c.StartAccess(serv)
+	if err != nil {
+		return err
+	}
+
+	return sess.Wait()
+}
+
+// Gains continuous access to the service and probes it. Returns the running
+// access session, which the caller should Stop once access is not needed
+// anymore.
+func (c *Client) StartAccess(serv services.Service) (*Session, error) {
 
 	for _, at := range serv.AccessType {
 		switch at {
 		case services.AccessTypeOpenSPA:
-			return AccessOpenSPAService(serv, true, c.OpenSPA.Path, c.OpenSPA.OSPA)
+			sess, err := StartOpenSPAService(serv, true, c.OpenSPA.Path, c.OpenSPA.OSPA)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := c.ProbeService(serv); err != nil {
+				sess.Stop()
+				return nil, err
+			}
+
+			return sess, nil
 		}
 	}
 
-	return errors.New("unsupported access type")
+	return nil, errors.New("unsupported access type")
 }
 
+// Probes all the ports of the service using the client's prober. Returns an
+// UnreachableError if any port is unreachable. Probing is skipped if the client
+// has no prober.
+func (c *Client) ProbeService(serv services.Service) error {
+	if c.Prober == nil {
+		return nil
+	}
+
+	statuses := make([]PortStatus, 0, len(serv.ProtoPort))
+	var unreachable []services.ProtoPort
+
+	for _, pp := range serv.ProtoPort {
+		res, err := c.Prober.Probe(serv.IP, pp)
+		statuses = append(statuses, PortStatus{pp, res, err})
+
+		fields := log.Fields{
+			"serviceName": serv.Name,
+			"port":        pp.String(),
+			"result":      res.String(),
+		}
+
+		switch res {
+		case probe.Unreachable:
+			unreachable = append(unreachable, pp)
+			log.WithFields(fields).WithError(err).Warning("Access granted but service unreachable")
+		case probe.Inconclusive:
+			log.WithFields(fields).WithError(err).Info("Access granted, reachability unknown")
+		default:
+			log.WithFields(fields).Info("Access granted and service reachable")
+		}
+	}
+
+	if c.OnProbe != nil {
+		c.OnProbe(serv, statuses)
+	}
+
+	if len(unreachable) > 0 {
+		return &UnreachableError{serv.Name, unreachable}
+	}
+
+	return nil
+}
+
+// Performs the OpenSPA access handshake for all the ports of the service and
+// waits for the OpenSPA clients to exit.
 func AccessOpenSPAService(serv services.Service, continuous bool, openspaPath, ospa string) error {
+	sess, err := StartOpenSPAService(serv, continuous, openspaPath, ospa)
+	if err != nil {
+		return err
+	}
+
+	return sess.Wait()
+}
+
+// Starts an OpenSPA client for each port of the service and returns without
+// waiting for them to exit.
+func StartOpenSPAService(serv services.Service, continuous bool, openspaPath, ospa string) (*Session, error) {
 
 	var defaultOpenSPAPort uint16 = 22211
 	client := openspa.Client{
@@ -30,6 +171,8 @@ func AccessOpenSPAService(serv services.Service, continuous bool, openspaPath, o
 		defaultOpenSPAPort,
 	}
 
+	sess := &Session{Service: serv, done: make(chan struct{})}
+
 	for _, port := range serv.ProtoPort {
 		req := openspa.Request{
 			port.Protocol.String(),
@@ -37,38 +180,58 @@ func AccessOpenSPAService(serv services.Service, continuous bool, openspaPath, o
 			port.Port,
 		}
 
-		err := client.Send(req, continuous)
+		cmd, err := client.Start(req, continuous)
 		if err != nil {
-			return err
+			go sess.wait()
+			sess.Stop()
+			return nil, err
 		}
+		sess.cmds = append(sess.cmds, cmd)
 	}
 
-	return nil
+	go sess.wait()
+	return sess, nil
 }
 
-func ConcurrentAccessServiceContinuous(c Client, srvs []services.Service) {
+// Accesses all the services concurrently and returns once all of the access
+// sessions have ended. The returned map contains the error of each service
+// whose access failed.
+func ConcurrentAccessServiceContinuous(c Client, srvs []services.Service) map[string]error {
 
-	failed := make(chan services.Service, 1)
+	type failure struct {
+		srv services.Service
+		err error
+	}
+
+	done := make(chan failure, len(srvs))
 
 	for _, srv := range srvs {
 		serviceToAccess := srv
 		go func() {
 			err := c.Access(serviceToAccess)
-			if err != nil {
-				log.Error(err)
-				failed <- serviceToAccess
-				return
-			}
+			done <- failure{serviceToAccess, err}
 		}()
 
 		time.Sleep(200) // small delay
 	}
 
-	for {
-		select {
-		case srv := <-failed:
-			log.WithField("serviceName", srv.Name).Error("Failed to access service")
+	failed := make(map[string]error)
+	for range srvs {
+		f := <-done
+		if f.err == nil {
+			continue
+		}
+
+		failed[f.srv.Name] = f.err
+
+		var unreachable *UnreachableError
+		if errors.As(f.err, &unreachable) {
+			log.WithField("serviceName", f.srv.Name).Error("Access granted but service unreachable")
+		} else {
+			log.Error(f.err)
+			log.WithField("serviceName", f.srv.Name).Error("Failed to access service")
 		}
 	}
 
+	return failed
 }
@@ -1,20 +1,91 @@
 package client
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
+	"errors"
+	"github.com/greenstatic/opensdp/internal/keys"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/probe"
+	"github.com/greenstatic/opensdp/internal/server"
+	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	netUrl "net/url"
+	"time"
+)
+
+const (
+	// Servers are tried in the configured order
+	ServerOrderSequential = "sequential"
+	// Servers are tried in a random order
+	ServerOrderRandom = "random"
 )
 
 type Client struct {
-	Server         string
-	CAPath         string
+	// OpenSDP servers (ip:port), tried in order until one responds
+	Servers []string
+	// Order in which the servers are tried, sequential or random. The server
+	// that last worked is always tried first.
+	ServerOrder string
+	// Timeout of a request to a single server (including retries), zero
+	// means no timeout
+	ServerTimeout time.Duration
+	Timeouts      Timeouts
+	// Number of times a failed request to a server is retried before
+	// failing over to the next server
+	Retries int
+	// Delay before the first retry, doubled for every following retry
+	RetryBackoff time.Duration
+	// File remembering the server that last worked, empty disables it
+	StatePath string
+
+	// CA verifying the server's certificate, may be empty if ServerPins are set
+	CAPath string
+	// Name expected in the server's certificate, DefaultServerName if empty
+	ServerName string
+	// Public key pins of the server (sha256/<base64 SPKI hash>). If set, the
+	// server or one of its CAs has to have a pinned key.
+	ServerPins     []string
 	ClientCertPath string
 	ClientKeyPath  string
-	OpenSPA        OpenSPADetails
+	// PKCS#12 bundle used instead of ClientCertPath and ClientKeyPath
+	ClientPKCS12Path string
+	// PKCS#11 token holding the client key, used instead of ClientKeyPath
+	ClientPKCS11 *keys.PKCS11Config
+	// Passphrase of an encrypted client key or PKCS#12 bundle, or the PIN of
+	// the PKCS#11 token
+	KeyPassphrase keys.PassphraseFunc
+	OpenSPA       OpenSPADetails
+	// Probes services after access is granted, nil disables probing
+	Prober *probe.Prober
+	// Called with the probe results of each probed service
+	OnProbe func(services.Service, []PortStatus)
+	// Collect the posture facts submitted with v1 discover requests, none
+	// are submitted if empty
+	PostureCollectors []posture.Collector
+
+	// Servers unlocked using OpenSPA
+	unlocked map[string]bool
+	// Reused for all requests, created on the first request
+	httpClient *http.Client
+	// API version negotiated with the server
+	api string
+	// Services of the last v1 discover, reused while their ETag matches
+	discovered     []services.Service
+	discoveredETag string
+	// Posture failures of the last v1 discover
+	postureFailures []server.PostureFailure
+}
+
+// Timeouts of the phases of a request, zero means no timeout
+type Timeouts struct {
+	Dial         time.Duration
+	TLSHandshake time.Duration
+	// Time to wait for the server's response headers after sending the request
+	Response time.Duration
 }
 
 type OpenSPADetails struct {
@@ -22,77 +93,285 @@ type OpenSPADetails struct {
 	OSPA string
 }
 
-// Perform a GET request on the urlpath of the client server. Return the
-// response as a byte slice.
-func (c *Client) Request(urlpath string) ([]byte, error) {
+// Perform a GET request on the urlpath of the client server. The servers are
+// tried one after another until one responds. Return the response as a byte
+// slice.
+func (c *Client) Request(ctx context.Context, urlpath string) ([]byte, error) {
+	return c.requestWithHeader(ctx, urlpath, nil)
+}
 
-	// Build url
-	urlRawStr := "https://" + c.Server
-	urlParsed, err := netUrl.Parse(urlRawStr)
-	if err != nil {
-		log.WithField("url", urlRawStr).Error("Failed to build server url")
+// Same as Request, with additional request headers.
+func (c *Client) requestWithHeader(ctx context.Context, urlpath string, header http.Header) ([]byte, error) {
+	if len(c.Servers) == 0 {
+		return nil, errors.New("no server configured")
+	}
+
+	if err := c.initHTTPClient(); err != nil {
 		return nil, err
 	}
 
-	url := urlParsed.String()
-	if url[len(url)-1:] != "/" {
-		url += "/"
+	var lastErr error
+	for _, server := range c.serverOrder() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := c.unlockServer(server); err != nil {
+			log.WithField("server", server).Warning("Failed to unlock the OpenSDP server using OpenSPA")
+			log.Warning(err)
+			lastErr = err
+			continue
+		}
+
+		body, err := c.requestWithRetries(ctx, server, urlpath, header)
+		if code, ok := statusCode(err); ok && code < 500 {
+			// The server handled the request, other servers would respond the same
+			return nil, err
+		}
+		if err != nil {
+			log.WithField("server", server).Warning("Request to server failed")
+			log.Warning(err)
+			lastErr = err
+			continue
+		}
+
+		c.rememberServer(server)
+		return body, nil
+	}
+
+	return nil, lastErr
+}
+
+// Returns the servers in the order they should be tried in
+func (c *Client) serverOrder() []string {
+	servers := make([]string, len(c.Servers))
+	copy(servers, c.Servers)
+
+	if c.ServerOrder == ServerOrderRandom {
+		rand.Shuffle(len(servers), func(i, j int) {
+			servers[i], servers[j] = servers[j], servers[i]
+		})
+	}
+
+	// Move the server that last worked to the front
+	last := c.lastServer()
+	for i, s := range servers {
+		if s == last {
+			copy(servers[1:i+1], servers[:i])
+			servers[0] = last
+			break
+		}
+	}
+
+	return servers
+}
+
+// Returns the server that last worked or an empty string if unknown
+func (c *Client) lastServer() string {
+	if c.StatePath == "" {
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(c.StatePath)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (c *Client) rememberServer(server string) {
+	if c.StatePath == "" || c.lastServer() == server {
+		return
+	}
+
+	if err := ioutil.WriteFile(c.StatePath, []byte(server), 0600); err != nil {
+		log.WithField("state", c.StatePath).Warning("Failed to remember the last working server")
+		log.Warning(err)
+	}
+}
+
+// Unlocks the server using OpenSPA, unless it was already unlocked
+func (c *Client) unlockServer(server string) error {
+	if c.unlocked[server] {
+		return nil
+	}
+
+	if err := UnlockOpenSDPServer(server, c.OpenSPA); err != nil {
+		return err
+	}
+
+	if c.unlocked == nil {
+		c.unlocked = make(map[string]bool)
+	}
+	c.unlocked[server] = true
+	return nil
+}
+
+// Forgets that the server was unlocked, so that it is knocked again. Used
+// when the server can not be reached, as its OpenSPA access may have expired
+// (eg. the server or its firewall restarted).
+func (c *Client) forgetUnlock(server string) {
+	delete(c.unlocked, server)
+}
+
+// Creates the HTTP client reused for all requests. The client's keypair and
+// the CA certificate are loaded only once.
+func (c *Client) initHTTPClient() error {
+	if c.httpClient != nil {
+		return nil
 	}
-	url += urlpath
 
 	log.WithFields(log.Fields{
-		"url":        url,
-		"ca":         c.CAPath,
-		"clientCert": c.ClientCertPath,
-		"clientKey":  c.ClientKeyPath}).Debug("Issuing services request")
+		"ca":           c.CAPath,
+		"serverName":   c.ServerName,
+		"serverPins":   c.ServerPins,
+		"clientCert":   c.ClientCertPath,
+		"clientKey":    c.ClientKeyPath,
+		"clientPKCS12": c.ClientPKCS12Path}).Debug("Loading client keypair")
 
 	// Adapted from: https://github.com/levigross/go-mutual-tls
 
-	cert, err := tls.LoadX509KeyPair(c.ClientCertPath, c.ClientKeyPath)
+	cert, err := keys.Source{
+		CertPath:   c.ClientCertPath,
+		KeyPath:    c.ClientKeyPath,
+		PKCS12Path: c.ClientPKCS12Path,
+		PKCS11:     c.ClientPKCS11,
+		Passphrase: c.KeyPassphrase,
+	}.Load()
 	if err != nil {
 		log.Error("Unable to load client keypair")
-		return nil, err
+		return err
 	}
 
-	clientCACert, err := ioutil.ReadFile(c.CAPath)
+	tlsConfig, err := c.tlsConfig(cert)
 	if err != nil {
-		log.Error("Unable to open ca certificate")
-		return nil, err
+		log.Error("Unable to configure server verification")
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: c.Timeouts.Dial}
+
+	c.httpClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   c.Timeouts.TLSHandshake,
+			ResponseHeaderTimeout: c.Timeouts.Response,
+			IdleConnTimeout:       90 * time.Second,
+			// Used if the server's TLS policy permits it
+			ForceAttemptHTTP2: true,
+		},
 	}
 
-	// Trust only the CA certificate
-	clientCertPool := x509.NewCertPool()
-	clientCertPool.AppendCertsFromPEM(clientCACert)
+	return nil
+}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      clientCertPool,
-		ServerName:   "OpenSDP-server",
+// Performs the request to the server, retrying with an exponential backoff
+// if it fails with a retryable error. Requests are GETs, which are idempotent.
+func (c *Client) requestWithRetries(ctx context.Context, server, urlpath string, header http.Header) ([]byte, error) {
+	if c.ServerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ServerTimeout)
+		defer cancel()
 	}
 
-	tlsConfig.BuildNameToCertificate()
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		// Knocks again if the previous attempt could not reach the server
+		if err := c.unlockServer(server); err != nil {
+			return nil, err
+		}
+
+		body, err := c.request(ctx, server, urlpath, header)
+		if _, ok := statusCode(err); err != nil && !ok {
+			c.forgetUnlock(server)
+		}
+		if err == nil || attempt >= c.Retries || !isRetryable(err) {
+			return body, err
+		}
 
-	client := http.Client{
-		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		log.WithFields(log.Fields{
+			"server":  server,
+			"attempt": attempt + 1,
+			"backoff": backoff.String(),
+		}).Debug("Request failed, retrying")
+		log.Debug(err)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
+}
 
-	resp, err := client.Get(url)
+// Perform a GET request on the urlpath of the server.
+func (c *Client) request(ctx context.Context, server, urlpath string, header http.Header) ([]byte, error) {
+	resp, err := c.get(ctx, server, urlpath, header)
 	if err != nil {
-		log.Error("Failed to connect to the server")
 		return nil, err
 	}
 
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Error("Failed to read response from server")
 		return nil, err
 	}
 
 	log.WithFields(log.Fields{
-		"url":            url,
+		"server":         server,
+		"urlpath":        urlpath,
 		"responseLength": len(body),
 	}).Debug("Successfully connected to the server")
 
 	return body, nil
 }
+
+// Issues a GET request on the urlpath of the server. Returns the response of
+// successful requests, the caller has to close its body.
+func (c *Client) get(ctx context.Context, server, urlpath string, header http.Header) (*http.Response, error) {
+
+	// Build url
+	urlRawStr := "https://" + server
+	urlParsed, err := netUrl.Parse(urlRawStr)
+	if err != nil {
+		log.WithField("url", urlRawStr).Error("Failed to build server url")
+		return nil, err
+	}
+
+	url := urlParsed.String()
+	if url[len(url)-1:] != "/" {
+		url += "/"
+	}
+	url += urlpath
+
+	log.WithField("url", url).Debug("Issuing services request")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if isTLSError(err) {
+			return nil, &TLSError{server, err}
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, responseError(server, resp.StatusCode, body)
+	}
+
+	return resp, nil
+}
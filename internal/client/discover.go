@@ -1,16 +1,100 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/greenstatic/opensdp/internal/server"
 	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// API versions of the server
+const (
+	apiLegacy = "legacy"
+	apiV1     = "v1"
 )
 
 // Performs the discover request and returns a slice of services the
 // client is authorized to access.
-func (c *Client) Discover() ([]services.Service, error) {
+func (c *Client) Discover(ctx context.Context) ([]services.Service, error) {
+	api, err := c.negotiateAPI(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if api == apiV1 {
+		return c.discoverV1(ctx)
+	}
+
+	return c.discoverLegacy(ctx)
+}
+
+// Returns the highest API version supported by both the client and the
+// server, based on the version field of the server's root endpoint.
+func (c *Client) negotiateAPI(ctx context.Context) (string, error) {
+	if c.api != "" {
+		return c.api, nil
+	}
+
+	data, err := c.Request(ctx, "")
+	if err != nil {
+		return "", err
+	}
+
+	c.api = apiLegacy
+	rr := server.RootResponse{}
+	if err := json.Unmarshal(data, &rr); err == nil && versionAtLeast(rr.Version, server.V1MinVersion) {
+		c.api = apiV1
+	}
+
+	log.WithFields(log.Fields{
+		"serverVersion": rr.Version,
+		"api":           c.api,
+	}).Debug("Negotiated API version")
+
+	return c.api, nil
+}
+
+// Performs the v1 discover request. The services of the previous request are
+// reused if the server responds that they have not changed.
+func (c *Client) discoverV1(ctx context.Context) ([]services.Service, error) {
+	header := c.postureHeader(ctx)
+	if c.discoveredETag != "" {
+		header.Set("If-None-Match", c.discoveredETag)
+	}
+
 	// Send request
-	data, err := c.Request("discover")
+	data, err := c.requestWithHeader(ctx, "v1/discover", header)
+	if code, ok := statusCode(err); ok && code == http.StatusNotModified {
+		log.Debug("Services not modified since the last discover")
+		return c.discovered, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	srvs, version, failures, err := decodeServices(data)
+	if err != nil {
+		return nil, err
+	}
+	logPostureFailures(failures)
+
+	c.discovered = srvs
+	c.postureFailures = failures
+	c.discoveredETag = ""
+	if version != "" {
+		c.discoveredETag = `"` + version + `"`
+	}
+
+	return srvs, nil
+}
+
+func (c *Client) discoverLegacy(ctx context.Context) ([]services.Service, error) {
+	// Send request
+	data, err := c.Request(ctx, "discover")
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +103,7 @@ func (c *Client) Discover() ([]services.Service, error) {
 	dr := server.DiscoverResponse{}
 	err = json.Unmarshal(data, &dr)
 	if err != nil {
-		return nil, err
+		return nil, &DecodeError{err}
 	}
 
 	// Convert to a services.Service slice
@@ -27,7 +111,7 @@ func (c *Client) Discover() ([]services.Service, error) {
 	for _, drs := range dr.Services {
 		srv, err := drs.ToService()
 		if err != nil {
-			return nil, err
+			return nil, &DecodeError{err}
 		}
 
 		srvs = append(srvs, srv)
@@ -35,3 +119,28 @@ func (c *Client) Discover() ([]services.Service, error) {
 
 	return srvs, nil
 }
+
+// Returns true if the dotted version (eg. 0.2.0) is equal or higher than min.
+// Unparsable versions are considered lower.
+func versionAtLeast(version, min string) bool {
+	v := strings.Split(version, ".")
+	m := strings.Split(min, ".")
+
+	for i := 0; i < len(m); i++ {
+		mi, _ := strconv.Atoi(m[i])
+
+		vi := 0
+		if i < len(v) {
+			var err error
+			if vi, err = strconv.Atoi(v[i]); err != nil {
+				return false
+			}
+		}
+
+		if vi != mi {
+			return vi > mi
+		}
+	}
+
+	return true
+}
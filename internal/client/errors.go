@@ -0,0 +1,194 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/server"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Returned when the TLS handshake with the server fails, eg. due to an
+// untrusted or invalid server certificate.
+type TLSError struct {
+	Server string
+	Err    error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("tls handshake with %s failed: %s", e.Server, describeTLSError(e.Err))
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+// Returned when the server responds with a non 2xx status code.
+type StatusError struct {
+	Server     string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server %s responded with %d %s", e.Server, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+var (
+	// The device is not known to the server
+	ErrUnauthorized = errors.New("device not authorized")
+	// The device is not authorized for any services
+	ErrNoServices = errors.New("not authorized for any services")
+	// The server failed to handle the request
+	ErrServerError = errors.New("server error")
+)
+
+// Returned when the server responds with a server.ErrorResponse. Use
+// errors.Is with ErrUnauthorized, ErrNoServices or ErrServerError to check
+// the kind of error.
+type APIError struct {
+	Server     string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server %s responded with %d %s: %s (%s)", e.Server, e.StatusCode,
+		http.StatusText(e.StatusCode), e.Message, e.Code)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Code == server.ErrorCodeUnauthorized
+	case ErrNoServices:
+		return e.Code == server.ErrorCodeNoServices
+	case ErrServerError:
+		return e.Code == server.ErrorCodeInternal || e.StatusCode >= 500
+	default:
+		return false
+	}
+}
+
+// Returns an APIError if the body is a server.ErrorResponse, otherwise a
+// StatusError.
+func responseError(srv string, statusCode int, body []byte) error {
+	er := server.ErrorResponse{}
+	if err := json.Unmarshal(body, &er); err == nil && er.Code != "" {
+		return &APIError{srv, statusCode, er.Code, er.Error}
+	}
+
+	return &StatusError{srv, statusCode, body}
+}
+
+// Returned when the server's response cannot be decoded.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode server response: %s", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Describes why the server's certificate failed verification and what to
+// check, falls back to the error itself.
+func describeTLSError(err error) string {
+	var pinErr *PinError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var unknownAuthErr x509.UnknownAuthorityError
+
+	switch {
+	case errors.As(err, &pinErr):
+		return fmt.Sprintf("%s (check server-pins)", pinErr)
+
+	case errors.As(err, &hostnameErr):
+		cert := hostnameErr.Certificate
+		names := cert.DNSNames
+		for _, ip := range cert.IPAddresses {
+			names = append(names, ip.String())
+		}
+		if len(names) == 0 && cert.Subject.CommonName != "" {
+			names = []string{cert.Subject.CommonName}
+		}
+		return fmt.Sprintf("server certificate is valid for %s, not for the expected server name %s (check server-name)",
+			strings.Join(names, ", "), hostnameErr.Host)
+
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		cert := invalidErr.Cert
+		if time.Now().Before(cert.NotBefore) {
+			return fmt.Sprintf("server certificate %s is not valid before %s (check the clock)",
+				cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+		}
+		return fmt.Sprintf("server certificate %s expired at %s",
+			cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+
+	case errors.As(err, &unknownAuthErr):
+		issuer := "unknown issuer"
+		if unknownAuthErr.Cert != nil {
+			issuer = unknownAuthErr.Cert.Issuer.String()
+		}
+		return fmt.Sprintf("server certificate issued by %s is not signed by the configured CA (check ca-cert)", issuer)
+	}
+
+	return err.Error()
+}
+
+// Returns true if err was caused by the TLS handshake
+func isTLSError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var pinErr *PinError
+
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &pinErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
+
+// Returns true if the request that failed with err may succeed when retried.
+// TLS errors and client errors (4xx) are permanent.
+func isRetryable(err error) bool {
+	var tlsErr *TLSError
+	if errors.As(err, &tlsErr) {
+		return false
+	}
+
+	if code, ok := statusCode(err); ok {
+		return code >= 500 || code == http.StatusTooManyRequests
+	}
+
+	var decodeErr *DecodeError
+	return !errors.As(err, &decodeErr)
+}
+
+// Returns the status code of the server's response that caused err
+func statusCode(err error) (int, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode, true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"errors"
+	"github.com/greenstatic/opensdp/internal/probe"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Forwards TCP connections from a local listener to a service port. Access to
+// the service is gained when the first connection arrives.
+type OnDemandForward struct {
+	// Local address to listen on (host:port)
+	Local   string
+	Service services.Service
+	// Remote TCP port of the service to forward to
+	Port uint16
+
+	client   *Client
+	listener net.Listener
+
+	mu      sync.Mutex
+	session *Session
+	// Closed once the access in progress completes, nil if none is
+	pending chan struct{}
+	closed  bool
+}
+
+func (c *Client) NewOnDemandForward(local string, serv services.Service, port uint16) (*OnDemandForward, error) {
+	found := false
+	for _, pp := range serv.ProtoPort {
+		if pp.Protocol == services.ProtocolTCP && pp.Port == port {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("service does not expose tcp port " + strconv.Itoa(int(port)))
+	}
+
+	found = false
+	for _, at := range serv.AccessType {
+		if at == services.AccessTypeOpenSPA {
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("unsupported access type")
+	}
+
+	return &OnDemandForward{Local: local, Service: serv, Port: port, client: c}, nil
+}
+
+// Listens on the local address and forwards incoming connections until Close
+// is called.
+func (f *OnDemandForward) Serve() error {
+	ln, err := net.Listen("tcp", f.Local)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	f.listener = ln
+	f.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"local":       ln.Addr().String(),
+		"serviceName": f.Service.Name,
+		"port":        f.Port,
+	}).Info("Listening for on-demand connections")
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			f.mu.Lock()
+			closed := f.closed
+			f.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		go f.handle(conn)
+	}
+}
+
+// Stops listening and ends the access session to the service.
+func (f *OnDemandForward) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.listener != nil {
+		f.listener.Close()
+	}
+	if f.session != nil {
+		f.session.Stop()
+		f.session = nil
+	}
+}
+
+// Gains access to the service unless an access session is already running.
+// Concurrent connections wait for the first one to complete the access. The
+// lock is not held while gaining access, so that Close does not wait for it.
+func (f *OnDemandForward) ensureAccess() error {
+	f.mu.Lock()
+	for f.pending != nil {
+		pending := f.pending
+		f.mu.Unlock()
+		<-pending
+		f.mu.Lock()
+	}
+
+	if f.closed {
+		f.mu.Unlock()
+		return errors.New("forward closed")
+	}
+
+	if f.session != nil {
+		select {
+		case <-f.session.Done():
+			log.WithField("serviceName", f.Service.Name).Warning("Access session ended, renewing access")
+			f.session = nil
+		default:
+			f.mu.Unlock()
+			return nil
+		}
+	}
+
+	done := make(chan struct{})
+	f.pending = done
+	f.mu.Unlock()
+
+	sess, err := f.access()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = nil
+	close(done)
+
+	if err != nil {
+		return err
+	}
+	if f.closed {
+		sess.Stop()
+		return errors.New("forward closed")
+	}
+
+	f.session = sess
+	return nil
+}
+
+// Starts an access session to the service and probes the port if enabled
+func (f *OnDemandForward) access() (*Session, error) {
+	log.WithField("serviceName", f.Service.Name).Info("Gaining on-demand access to service")
+
+	sess, err := StartOpenSPAService(f.Service, true, f.client.OpenSPA.Path, f.client.OpenSPA.OSPA)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.client.Prober != nil {
+		pp := services.ProtoPort{Protocol: services.ProtocolTCP, Port: f.Port}
+		res, err := f.client.Prober.Probe(f.Service.IP, pp)
+		if res == probe.Unreachable {
+			sess.Stop()
+			log.WithError(err).WithField("serviceName", f.Service.Name).Warning("Access granted but service unreachable")
+			return nil, &UnreachableError{f.Service.Name, []services.ProtoPort{pp}}
+		}
+	}
+
+	return sess, nil
+}
+
+func (f *OnDemandForward) handle(local net.Conn) {
+	defer local.Close()
+
+	logger := log.WithFields(log.Fields{
+		"serviceName": f.Service.Name,
+		"remote":      local.RemoteAddr().String(),
+	})
+
+	if err := f.ensureAccess(); err != nil {
+		logger.WithError(err).Error("Failed to access service")
+		return
+	}
+
+	target := net.JoinHostPort(f.Service.IP.String(), strconv.Itoa(int(f.Port)))
+	remote, err := net.Dial("tcp", target)
+	if err != nil {
+		logger.WithError(err).Error("Failed to connect to service")
+		return
+	}
+	defer remote.Close()
+
+	logger.Debug("Proxying connection")
+	proxy(local, remote)
+	logger.Debug("Connection closed")
+}
+
+// Copies data in both directions until both sides are done
+func proxy(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		// Signal EOF to the other side while allowing the reverse direction to finish
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	go cp(a, b)
+	go cp(b, a)
+	wg.Wait()
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/server"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Returns the request header carrying the device's posture facts, collected
+// anew for every request. The header is empty without collectors.
+func (c *Client) postureHeader(ctx context.Context) http.Header {
+	header := http.Header{}
+	if len(c.PostureCollectors) == 0 {
+		return header
+	}
+
+	header.Set(posture.Header, posture.Collect(ctx, c.PostureCollectors).Encode())
+	return header
+}
+
+// Returns the posture requirements not met by the device, whose services the
+// last discover withheld.
+func (c *Client) PostureFailures() []server.PostureFailure {
+	return c.postureFailures
+}
+
+func logPostureFailures(failures []server.PostureFailure) {
+	for _, f := range failures {
+		log.WithFields(log.Fields{
+			"service":     f.Service,
+			"fact":        f.Fact,
+			"requirement": f.Requirement,
+			"actual":      f.Actual,
+		}).Warning("Service withheld, posture requirement not met")
+	}
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"errors"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Delays before retrying access to a service that failed, doubling with each
+// consecutive failure
+const (
+	retryMinDelay = 5 * time.Second
+	retryMaxDelay = 5 * time.Minute
+)
+
+// Keeps an access session running for each service of the latest service set,
+// used to follow the service set changes of WatchServices.
+type SessionSet struct {
+	client *Client
+
+	// Guards sessions and retries, Update may be called concurrently
+	mu       sync.Mutex
+	sessions map[string]*Session
+	retries  map[string]*retry
+}
+
+// Backoff of a service whose access failed
+type retry struct {
+	srv      services.Service
+	failures int
+	next     time.Time
+}
+
+func (c *Client) NewSessionSet() *SessionSet {
+	return &SessionSet{client: c, sessions: make(map[string]*Session), retries: make(map[string]*retry)}
+}
+
+// Stops the sessions of services that are no longer in srvs or have changed
+// and starts access to the new ones. Sessions that have ended are restarted,
+// services whose access failed are retried with backoff, so Update should also
+// be called periodically with the latest srvs. Returns once all new sessions
+// were started, with the errors of the services whose access failed.
+func (s *SessionSet) Update(srvs []services.Service) map[string]error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]services.Service, len(srvs))
+	for _, srv := range srvs {
+		wanted[srv.Name] = srv
+	}
+
+	for name, sess := range s.sessions {
+		srv, ok := wanted[name]
+		ended := sessionEnded(sess)
+		if ok && reflect.DeepEqual(srv, sess.Service) && !ended {
+			continue
+		}
+
+		switch {
+		case !ok:
+			log.WithField("serviceName", name).Info("Access revoked, stopping access")
+		case ended:
+			log.WithField("serviceName", name).WithError(sess.Wait()).Warning("Access session ended, restarting")
+		}
+		sess.Stop()
+		delete(s.sessions, name)
+	}
+
+	for name, r := range s.retries {
+		srv, ok := wanted[name]
+		// Changed services are retried right away
+		if !ok || !reflect.DeepEqual(srv, r.srv) {
+			delete(s.retries, name)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make(map[string]error)
+	now := time.Now()
+
+	for _, srv := range srvs {
+		if _, ok := s.sessions[srv.Name]; ok {
+			continue
+		}
+		if r, ok := s.retries[srv.Name]; ok && now.Before(r.next) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(srv services.Service) {
+			defer wg.Done()
+
+			log.WithField("serviceName", srv.Name).Info("Gaining access to service")
+			sess, err := s.client.StartAccess(srv)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				failed[srv.Name] = err
+
+				var unreachable *UnreachableError
+				if errors.As(err, &unreachable) {
+					log.WithField("serviceName", srv.Name).Error("Access granted but service unreachable")
+				} else {
+					log.Error(err)
+					log.WithField("serviceName", srv.Name).Error("Failed to access service")
+				}
+				return
+			}
+
+			s.sessions[srv.Name] = sess
+		}(srv)
+	}
+
+	wg.Wait()
+
+	for _, srv := range srvs {
+		if _, ok := failed[srv.Name]; !ok {
+			if _, ok := s.sessions[srv.Name]; ok {
+				delete(s.retries, srv.Name)
+			}
+			continue
+		}
+
+		r, ok := s.retries[srv.Name]
+		if !ok {
+			r = &retry{}
+			s.retries[srv.Name] = r
+		}
+		r.failures++
+		r.next = now.Add(retryDelay(r.failures))
+		r.srv = srv
+
+		log.WithFields(log.Fields{
+			"serviceName": srv.Name,
+			"retryAt":     r.next.Format(time.RFC3339),
+		}).Info("Retrying access to service later")
+	}
+
+	return failed
+}
+
+// Returns the delay before retrying after the number of consecutive failures
+func retryDelay(failures int) time.Duration {
+	d := retryMinDelay
+	for i := 1; i < failures && d < retryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d
+}
+
+// Returns the number of sessions that have not ended
+func (s *SessionSet) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, sess := range s.sessions {
+		if !sessionEnded(sess) {
+			n++
+		}
+	}
+	return n
+}
+
+// Stops all running sessions
+func (s *SessionSet) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, sess := range s.sessions {
+		sess.Stop()
+		delete(s.sessions, name)
+	}
+}
+
+func sessionEnded(sess *Session) bool {
+	select {
+	case <-sess.Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"github.com/greenstatic/opensdp/internal/services"
+	"net"
+	"strconv"
+)
+
+// Unlocks the OpenSDP server (ip:port) using OpenSPA, so that it can be
+// reached over HTTPS.
+func UnlockOpenSDPServer(server string, openspaD OpenSPADetails) error {
+	// Parse the OpenSDP server IP and port
+	opensdpIp, opensdpPortStr, err := net.SplitHostPort(server)
+	if err != nil {
+		return err
+	}
+
+	opensdpPortInt, err := strconv.ParseUint(opensdpPortStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(opensdpIp)
+	if ip == nil {
+		return &net.ParseError{Type: "IP address", Text: opensdpIp}
+	}
+
+	// Create pseudo OpenSDP service
+	opensdpService := services.Service{
+		IP:        ip,
+		ProtoPort: []services.ProtoPort{{Protocol: services.ProtocolTCP, Port: uint16(opensdpPortInt)}},
+	}
+
+	// Using OpenSPA request access to the OpenSDP server
+	return AccessOpenSPAService(opensdpService, false, openspaD.Path, openspaD.OSPA)
+}
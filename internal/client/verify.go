@@ -0,0 +1,159 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Name expected in the server's certificate unless configured otherwise
+const DefaultServerName = "OpenSDP-server"
+
+// Prefix of public key pins, followed by the base64 SHA-256 hash of the
+// certificate's SubjectPublicKeyInfo
+const pinPrefix = "sha256/"
+
+// Returned when none of the server's public keys matches the pinned keys
+type PinError struct {
+	// Pins of the certificates presented by the server
+	Pins []string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("server public key %s matches none of the pinned keys", strings.Join(e.Pins, ", "))
+}
+
+// Returns the pin of the certificate's public key, eg. sha256/uU0W87bi...=
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Validates the pin and returns it in the sha256/<base64> form. The curl
+// form sha256//<base64> is accepted as well.
+func normalizePin(pin string) (string, error) {
+	if !strings.HasPrefix(pin, pinPrefix) {
+		return "", fmt.Errorf("bad pin %s, expected %s<base64 sha256 hash>", pin, pinPrefix)
+	}
+
+	hash := strings.TrimPrefix(strings.TrimPrefix(pin, pinPrefix), "/")
+	sum, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf("bad pin %s, expected %s<base64 sha256 hash>", pin, pinPrefix)
+	}
+
+	return pinPrefix + hash, nil
+}
+
+// Returns the TLS config verifying the server. The server's certificate is
+// verified using the CA and its name, and its public key (or one of its
+// chains' when verified using the CA) has to match one of the pins if any are
+// configured. Without a CA the pins, the validity period and the name are
+// verified.
+func (c *Client) tlsConfig(cert tls.Certificate) (*tls.Config, error) {
+	serverName := c.ServerName
+	if serverName == "" {
+		serverName = DefaultServerName
+	}
+
+	pins := make(map[string]bool, len(c.ServerPins))
+	for _, p := range c.ServerPins {
+		pin, err := normalizePin(p)
+		if err != nil {
+			return nil, err
+		}
+		pins[pin] = true
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   serverName,
+	}
+
+	if c.CAPath == "" {
+		if len(pins) == 0 {
+			return nil, errors.New("neither a ca certificate nor server pins configured")
+		}
+
+		// Verified by VerifyConnection using the pins only, the checks skipped
+		// along with the chain are done by hand
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			leaf := cs.PeerCertificates[0]
+			if err := verifyPins([]*x509.Certificate{leaf}, pins); err != nil {
+				return err
+			}
+			return verifyLeaf(leaf, serverName, time.Now())
+		}
+		return tlsConfig, nil
+	}
+
+	caCert, err := ioutil.ReadFile(c.CAPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trust only the CA certificate
+	rootCAs := x509.NewCertPool()
+	if ok := rootCAs.AppendCertsFromPEM(caCert); !ok {
+		return nil, errors.New("no certificates found in ca certificate file")
+	}
+	tlsConfig.RootCAs = rootCAs
+
+	if len(pins) > 0 {
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.VerifiedChains) == 0 {
+				return verifyPins(cs.PeerCertificates, pins)
+			}
+			// The server's certificate may chain to the CA in several ways (eg.
+			// through a cross-signed intermediate), any of them may be pinned
+			return verifyPins(chainsCerts(cs.VerifiedChains), pins)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Returns an error unless the certificate is currently valid and issued for
+// the server name, as checked when verifying the chain
+func verifyLeaf(leaf *x509.Certificate, serverName string, now time.Time) error {
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return x509.CertificateInvalidError{Cert: leaf, Reason: x509.Expired}
+	}
+	return leaf.VerifyHostname(serverName)
+}
+
+// Returns the certificates of all chains, each once
+func chainsCerts(chains [][]*x509.Certificate) []*x509.Certificate {
+	var certs []*x509.Certificate
+	seen := make(map[string]bool)
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if !seen[string(cert.Raw)] {
+				seen[string(cert.Raw)] = true
+				certs = append(certs, cert)
+			}
+		}
+	}
+	return certs
+}
+
+// Returns a PinError unless one of the certificates' public keys is pinned
+func verifyPins(certs []*x509.Certificate, pins map[string]bool) error {
+	presented := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		pin := SPKIPin(cert)
+		if pins[pin] {
+			return nil
+		}
+		presented = append(presented, pin)
+	}
+
+	return &PinError{presented}
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/greenstatic/opensdp/internal/server"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Longest delay between reconnection attempts of a broken watch
+const maxWatchBackoff = 30 * time.Second
+
+// Time without receiving anything, keep-alives included, after which a watch
+// is considered broken and reconnected. The server sends a keep-alive every
+// 30s, so a few may be late or lost.
+const watchIdleTimeout = 90 * time.Second
+
+// Ends watches the server stopped sending on, eg. after a half-open connection
+var errWatchIdle = errors.New("nothing received from the server within " + watchIdleTimeout.String())
+
+// Returned by WatchServices when the server's API does not support watching
+var ErrWatchUnsupported = errors.New("server does not support watching services")
+
+// Subscribes to changes of the services the client is authorized for. fn is
+// called with the complete service set once subscribed and again whenever it
+// changes. Broken subscriptions are reconnected, failing over to the other
+// servers. Returns nil once ctx is done, otherwise the error that ended the
+// subscription (eg. ErrUnauthorized).
+func (c *Client) WatchServices(ctx context.Context, fn func([]services.Service)) error {
+	api, err := c.negotiateAPI(ctx)
+	if err != nil {
+		return err
+	}
+
+	if api != apiV1 {
+		return ErrWatchUnsupported
+	}
+
+	backoff := c.RetryBackoff
+	for {
+		// Cancelled to end the stream once it is idle
+		streamCtx, cancel := context.WithCancel(ctx)
+
+		// Posture is collected again on every reconnect
+		body, err := c.stream(streamCtx, "v1/discover/watch", c.postureHeader(ctx))
+		if code, ok := statusCode(err); ok && code < 500 {
+			cancel()
+			if code == http.StatusNotFound {
+				return ErrWatchUnsupported
+			}
+			return err
+		}
+
+		if err == nil {
+			backoff = c.RetryBackoff
+			r := newIdleReader(body, watchIdleTimeout, cancel)
+			err = readServiceEvents(r, fn)
+			if r.idle() {
+				err = errWatchIdle
+			}
+			r.stop()
+			body.Close()
+		}
+		cancel()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err == nil {
+			// The server ends watches once the posture is too old
+			log.Info("Server ended watching services, reconnecting")
+		} else {
+			log.WithField("backoff", backoff.String()).Warning("Watching services failed, reconnecting")
+			log.Warning(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+		if backoff <= 0 {
+			backoff = time.Second
+		}
+	}
+}
+
+// Opens the streaming urlpath on the first server that responds. The caller
+// has to close the returned body.
+func (c *Client) stream(ctx context.Context, urlpath string, header http.Header) (io.ReadCloser, error) {
+	if len(c.Servers) == 0 {
+		return nil, errors.New("no server configured")
+	}
+
+	if err := c.initHTTPClient(); err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range c.serverOrder() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := c.unlockServer(server); err != nil {
+			log.WithField("server", server).Warning("Failed to unlock the OpenSDP server using OpenSPA")
+			log.Warning(err)
+			lastErr = err
+			continue
+		}
+
+		resp, err := c.get(ctx, server, urlpath, header)
+		code, ok := statusCode(err)
+		if ok && code < 500 {
+			return nil, err
+		}
+		if err != nil && !ok {
+			// Knocked again on the next reconnect
+			c.forgetUnlock(server)
+		}
+		if err != nil {
+			log.WithField("server", server).Warning("Request to server failed")
+			log.Warning(err)
+			lastErr = err
+			continue
+		}
+
+		log.WithField("server", server).Info("Watching services for changes")
+		c.rememberServer(server)
+		return resp.Body, nil
+	}
+
+	return nil, lastErr
+}
+
+// Calls cancel unless each read returns data within the timeout
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	fired   int32
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	ir := &idleReader{r: r, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&ir.fired, 1)
+		cancel()
+	})
+	return ir
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
+
+// Returns true if the timeout expired
+func (ir *idleReader) idle() bool {
+	return atomic.LoadInt32(&ir.fired) == 1
+}
+
+func (ir *idleReader) stop() {
+	ir.timer.Stop()
+}
+
+// Reads the server-sent events of the watch stream and calls fn with the
+// service set of each services event. Returns once the stream ends.
+func readServiceEvents(r io.Reader, fn func([]services.Service)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	event := ""
+	var data strings.Builder
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// Blank lines dispatch the event
+			if event == "services" && data.Len() > 0 {
+				srvs, _, failures, err := decodeServices([]byte(data.String()))
+				if err != nil {
+					return err
+				}
+				logPostureFailures(failures)
+				fn(srvs)
+			}
+			event = ""
+			data.Reset()
+
+		case strings.HasPrefix(line, ":"):
+			// Comment, used for keep-alives
+
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Decodes a v1 discover response into a services.Service slice. Returns the
+// version of the service set and the posture failures as well.
+func decodeServices(data []byte) ([]services.Service, string, []server.PostureFailure, error) {
+	dr := server.DiscoverV1Response{}
+	if err := json.Unmarshal(data, &dr); err != nil {
+		return nil, "", nil, &DecodeError{err}
+	}
+
+	srvs := make([]services.Service, 0, len(dr.Services))
+	for _, ds := range dr.Services {
+		srv, err := ds.ToService()
+		if err == server.ErrPortRange {
+			log.WithField("service", ds.Name).Warning("Skipping service with a port range, not supported by this client")
+			continue
+		}
+		if err != nil {
+			return nil, "", nil, &DecodeError{err}
+		}
+
+		srvs = append(srvs, srv)
+	}
+
+	return srvs, dr.Version, dr.PostureFailures, nil
+}
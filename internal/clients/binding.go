@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Binds a device to a specific certificate. Certificates issued for the
+// device's identity that don't match the binding are rejected.
+type CertBinding struct {
+	// Serial number of the certificate, nil if not bound
+	Serial *big.Int
+	// SHA-256 fingerprint of the certificate (lowercase hex), empty if not bound
+	Fingerprint string
+}
+
+// Returns true if the device is bound to a certificate
+func (b CertBinding) Bound() bool {
+	return b.Serial != nil || b.Fingerprint != ""
+}
+
+// Returns an error if the certificate does not match the binding
+func (b CertBinding) Verify(cert *x509.Certificate) error {
+	if b.Serial != nil && b.Serial.Cmp(cert.SerialNumber) != 0 {
+		return fmt.Errorf("certificate serial %s does not match the bound serial %s",
+			FormatSerial(cert.SerialNumber), FormatSerial(b.Serial))
+	}
+
+	if b.Fingerprint != "" && b.Fingerprint != Fingerprint(cert) {
+		return fmt.Errorf("certificate fingerprint %s does not match the bound fingerprint %s",
+			Fingerprint(cert), b.Fingerprint)
+	}
+
+	return nil
+}
+
+// Returns the SHA-256 fingerprint of the certificate as lowercase hex
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Parses a SHA-256 fingerprint, either plain or colon separated hex (as
+// printed by openssl x509 -fingerprint -sha256). Returns it as lowercase hex.
+func ParseFingerprint(s string) (string, error) {
+	fp := strings.ToLower(strings.ReplaceAll(s, ":", ""))
+	if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("bad sha256 fingerprint %s", s)
+	}
+	return fp, nil
+}
+
+// Parses a certificate serial number in hex, plain or colon separated (as
+// printed by openssl x509 -serial)
+func ParseSerial(s string) (*big.Int, error) {
+	hexSerial := strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(s), "0x"), ":", "")
+	serial, ok := new(big.Int).SetString(hexSerial, 16)
+	if !ok || hexSerial == "" || serial.Sign() < 0 {
+		return nil, errors.New("bad certificate serial " + s + ", expected hex")
+	}
+	return serial, nil
+}
+
+// Formats a certificate serial number as uppercase hex
+func FormatSerial(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
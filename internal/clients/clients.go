@@ -10,4 +10,8 @@ type Client struct {
 	DeviceId string
 	Label    string
 	Services []ServicePolicy
+	// Groups the device belongs to, available to policy rules
+	Groups []string
+	// Certificate the device is bound to, if any
+	Cert CertBinding
 }
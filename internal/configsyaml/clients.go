@@ -2,10 +2,10 @@ package configsyaml
 
 import (
 	"errors"
+	"fmt"
 	"github.com/greenstatic/opensdp/internal/clients"
 	"github.com/greenstatic/opensdp/internal/services"
 	"github.com/satori/go.uuid"
-	"gopkg.in/yaml.v2"
 	"io/ioutil"
 )
 
@@ -17,6 +17,11 @@ type clientFile struct {
 	DeviceId string `yaml:"deviceId"`
 	Label    string
 	Services []clientFileServicePolicy
+	Groups   []string
+	// Binds the device to the certificate with the serial (hex) and/or
+	// SHA-256 fingerprint
+	CertSerial      string `yaml:"certSerial"`
+	CertFingerprint string `yaml:"certFingerprint"`
 }
 
 type clientsFile struct {
@@ -25,7 +30,15 @@ type clientsFile struct {
 	Clients []clientFile
 }
 
-func ClientsRead(path string, serv []services.Service) (map[string]clients.Client, error) {
+// Reads the clients file. Device IDs are validated and normalized using
+// parseDeviceId, if nil they have to be UUIDs.
+func ClientsRead(path string, serv []services.Service, parseDeviceId func(string) (string, error)) (
+	map[string]clients.Client, error) {
+
+	if parseDeviceId == nil {
+		parseDeviceId = parseUUID
+	}
+
 	m := make(map[string]clients.Client)
 
 	// Read file
@@ -36,7 +49,7 @@ func ClientsRead(path string, serv []services.Service) (map[string]clients.Clien
 
 	// Parse file
 	cf := clientsFile{}
-	err = yaml.Unmarshal(data, &cf)
+	err = unmarshalFile(data, &cf)
 	if err != nil {
 		return nil, err
 	}
@@ -47,10 +60,16 @@ func ClientsRead(path string, serv []services.Service) (map[string]clients.Clien
 	}
 
 	// Parse clients
-	for _, c := range cf.Clients {
-		clnt, err := parseClient(c, serv)
+	for i, c := range cf.Clients {
+		clnt, err := parseClient(c, serv, parseDeviceId)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("clients[%d] %s: %s", i, c.DeviceId, err)
+		}
+
+		// A later entry would silently replace the device's services and
+		// certificate binding
+		if _, ok := m[clnt.DeviceId]; ok {
+			return nil, fmt.Errorf("clients[%d]: duplicate device id %s", i, clnt.DeviceId)
 		}
 		m[clnt.DeviceId] = clnt
 	}
@@ -59,7 +78,9 @@ func ClientsRead(path string, serv []services.Service) (map[string]clients.Clien
 }
 
 // Parses a clientFile struct into a clients.Client with resolved services
-func parseClient(c clientFile, serv []services.Service) (clients.Client, error) {
+func parseClient(c clientFile, serv []services.Service, parseDeviceId func(string) (string, error)) (
+	clients.Client, error) {
+
 	clnt := clients.Client{}
 
 	// Parse deviceId
@@ -67,14 +88,30 @@ func parseClient(c clientFile, serv []services.Service) (clients.Client, error)
 		return clients.Client{}, errors.New("clients missing deviceId")
 	}
 
-	_, err := uuid.FromString(c.DeviceId)
+	deviceId, err := parseDeviceId(c.DeviceId)
 	if err != nil {
 		return clients.Client{}, err
 	}
-	clnt.DeviceId = c.DeviceId
+	clnt.DeviceId = deviceId
+
+	// Parse certificate binding
+	if c.CertSerial != "" {
+		if clnt.Cert.Serial, err = clients.ParseSerial(c.CertSerial); err != nil {
+			return clients.Client{}, err
+		}
+	}
+
+	if c.CertFingerprint != "" {
+		if clnt.Cert.Fingerprint, err = clients.ParseFingerprint(c.CertFingerprint); err != nil {
+			return clients.Client{}, err
+		}
+	}
 
 	// Parse label
-	clnt.Label = clnt.Label
+	clnt.Label = c.Label
+
+	// Parse groups
+	clnt.Groups = c.Groups
 
 	// Parse client's service policy
 	for _, csp := range c.Services {
@@ -104,8 +141,17 @@ func resolveClientsFileServicePolicy(csp clientFileServicePolicy, serv []service
 	}
 
 	if !found {
-		return clients.ServicePolicy{}, errors.New("non-existing service")
+		return clients.ServicePolicy{}, fmt.Errorf("non-existing service %s", csp.Name)
 	}
 
 	return sp, nil
 }
+
+// Default device ID validation, device IDs are the UUIDs in the certificates'
+// common name
+func parseUUID(deviceId string) (string, error) {
+	if _, err := uuid.FromString(deviceId); err != nil {
+		return "", err
+	}
+	return deviceId, nil
+}
@@ -0,0 +1,145 @@
+package configsyaml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// Unknown fields preventing a file's upgrade, since the current schema
+// version rejects them
+type UnknownFieldsError struct {
+	Problems []Problem
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return fmt.Sprintf("%d unknown fields, fix or remove them before upgrading", len(e.Problems))
+}
+
+// Upgrades the services or clients file to the current schema version.
+// Returns the upgraded file and the version it had, the file is returned
+// unchanged if it already is current. Comments and formatting are kept.
+func Migrate(path string) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, "", errors.New("file is not a mapping")
+	}
+	root := doc.Content[0]
+
+	h := fileHeader{}
+	var versionNode *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "version":
+			versionNode = root.Content[i+1]
+			h.Version = versionNode.Value
+		case "kind":
+			h.Kind = root.Content[i+1].Value
+		}
+	}
+
+	if err := checkVersion(h.Version); err != nil {
+		return nil, h.Version, err
+	}
+	if h.Version == SchemaVersion {
+		return data, h.Version, nil
+	}
+
+	v := &validator{file: path}
+	switch h.Kind {
+	case "services":
+		v.servicesFile()
+	case "clients":
+		// Device IDs depend on the identity config and don't change
+		v.clientsFile(nil, func(id string) (string, error) { return id, nil })
+	default:
+		return nil, h.Version, errors.New("file not kind services or clients")
+	}
+
+	if len(v.unknown) > 0 {
+		return nil, h.Version, &UnknownFieldsError{v.unknown}
+	}
+
+	version := h.Version
+	for _, m := range migrations {
+		if m.from == version {
+			version = m.to
+		}
+	}
+	if version != SchemaVersion {
+		return nil, h.Version, fmt.Errorf("no upgrade from version %s to %s", h.Version, SchemaVersion)
+	}
+
+	return setVersion(data, versionNode, version), h.Version, nil
+}
+
+// Replaces the version scalar in the file, keeping the rest as is
+func setVersion(data []byte, n *yaml.Node, version string) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	line := lines[n.Line-1]
+	col := n.Column - 1
+
+	token := []byte(n.Value)
+	replacement := []byte(version)
+	if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		quote := line[col : col+1]
+		token = append(append(append([]byte{}, quote...), token...), quote...)
+		replacement = append(append(append([]byte{}, quote...), replacement...), quote...)
+	}
+
+	var b bytes.Buffer
+	b.Write(line[:col])
+	b.Write(replacement)
+	b.Write(line[col+len(token):])
+	lines[n.Line-1] = b.Bytes()
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// Copies the file to a backup named after its old version (eg.
+// services.yaml.0.1.0), numbered if such a backup already exists (eg.
+// services.yaml.0.1.0.1), so earlier backups are never overwritten. Returns
+// the path of the backup.
+func Backup(path, version string, mode os.FileMode) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; ; i++ {
+		backup := path + "." + version
+		if i > 0 {
+			backup += "." + strconv.Itoa(i)
+		}
+
+		f, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(backup)
+			return "", err
+		}
+		return backup, nil
+	}
+}
@@ -0,0 +1,150 @@
+package configsyaml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrate(t *testing.T) {
+	old := strings.Replace(testServices, "version: 0.2.0", "version: 0.1.0", 1)
+
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"unquoted", old, testServices},
+		{"double quoted",
+			strings.Replace(testServices, "version: 0.2.0", `version: "0.1.0"`, 1),
+			strings.Replace(testServices, "version: 0.2.0", `version: "0.2.0"`, 1)},
+		{"single quoted",
+			strings.Replace(testServices, "version: 0.2.0", `version: '0.1.0'`, 1),
+			strings.Replace(testServices, "version: 0.2.0", `version: '0.2.0'`, 1)},
+		// Comments, other lines and line endings are kept
+		{"comment", "# Services\nkind: services\nversion:   0.1.0  # old\nservices: []\n",
+			"# Services\nkind: services\nversion:   0.2.0  # old\nservices: []\n"},
+		{"crlf", strings.Replace(old, "\n", "\r\n", -1), strings.Replace(testServices, "\n", "\r\n", -1)},
+		{"clients", strings.Replace(testClients, "version: 0.2.0", "version: 0.1.0", 1), testClients},
+	}
+
+	for _, tt := range tests {
+		path := writeFile(t, "services.yaml", tt.file)
+
+		data, from, err := Migrate(path)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if from != "0.1.0" {
+			t.Errorf("%s: from %s", tt.name, from)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, data, tt.want)
+		}
+	}
+
+	// The upgraded file is read
+	path := writeFile(t, "services.yaml", old)
+	data, _, err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if srvs, err := ServicesRead(path); err != nil || len(srvs) != 2 {
+		t.Errorf("ServicesRead = %v, %v", srvs, err)
+	}
+}
+
+func TestMigrateCurrent(t *testing.T) {
+	path := writeFile(t, "services.yaml", testServices)
+
+	data, from, err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != SchemaVersion || string(data) != testServices {
+		t.Errorf("got %s %q", from, data)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	unknown := strings.Replace(testServices, "version: 0.2.0", "version: 0.1.0", 1) + "  tag: [www]\n"
+
+	_, _, err := Migrate(writeFile(t, "services.yaml", unknown))
+	fieldsErr, ok := err.(*UnknownFieldsError)
+	if !ok {
+		t.Fatalf("got %v, want UnknownFieldsError", err)
+	}
+	if len(fieldsErr.Problems) != 1 || fieldsErr.Problems[0].Path != "services[1].tag" {
+		t.Errorf("got problems %v", fieldsErr.Problems)
+	}
+
+	for name, file := range map[string]string{
+		"unsupported version": strings.Replace(testServices, "version: 0.2.0", "version: 9.0.0", 1),
+		"missing version":     strings.Replace(testServices, "version: 0.2.0\n", "", 1),
+		"wrong kind":          "version: 0.1.0\nkind: servers\n",
+		"not a mapping":       "- version: 0.1.0\n",
+	} {
+		if _, _, err := Migrate(writeFile(t, "services.yaml", file)); err == nil {
+			t.Errorf("%s: Migrate succeeded", name)
+		}
+	}
+}
+
+// Backups are numbered instead of overwriting earlier ones
+func TestBackup(t *testing.T) {
+	path := writeFile(t, "services.yaml", "first")
+
+	want := []string{path + ".0.1.0", path + ".0.1.0.1", path + ".0.1.0.2"}
+	contents := []string{"first", "second", "third"}
+
+	for i := range want {
+		if err := ioutil.WriteFile(path, []byte(contents[i]), 0640); err != nil {
+			t.Fatal(err)
+		}
+
+		backup, err := Backup(path, "0.1.0", 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backup != want[i] {
+			t.Errorf("backup %d is %s, want %s", i, backup, want[i])
+		}
+	}
+
+	for i, backup := range want {
+		data, err := ioutil.ReadFile(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents[i] {
+			t.Errorf("%s contains %q, want %q", backup, data, contents[i])
+		}
+
+		info, err := os.Stat(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %s", backup, info.Mode())
+		}
+	}
+
+	if _, err := Backup(filepath.Join(filepath.Dir(path), "missing.yaml"), "0.1.0", 0600); err == nil {
+		t.Error("Backup of a missing file succeeded")
+	}
+}
@@ -3,9 +3,10 @@ package configsyaml
 import (
 	"errors"
 	"fmt"
+	"github.com/greenstatic/opensdp/internal/policy"
+	"github.com/greenstatic/opensdp/internal/posture"
 	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"net"
 	"strconv"
@@ -20,6 +21,11 @@ type serviceFile struct {
 	Ports      []ports
 	Tags       []string
 	AccessType []string `yaml:"accessType"`
+	// Conditions on posture facts by fact name, eg. os-version: ">= 13.4"
+	Posture map[string]string
+	// Policy rules, each either allow or deny with an expression, eg.
+	// - allow: '"admins" in device.groups'
+	Policy []map[string]string
 }
 
 type servicesFile struct {
@@ -38,7 +44,7 @@ func ServicesRead(path string) ([]services.Service, error) {
 
 	// Parse file
 	sf := servicesFile{}
-	err = yaml.Unmarshal(data, &sf)
+	err = unmarshalFile(data, &sf)
 	if err != nil {
 		return nil, err
 	}
@@ -50,10 +56,16 @@ func ServicesRead(path string) ([]services.Service, error) {
 
 	// Parse service
 	allServices := make([]services.Service, 0, len(sf.Services))
-	for _, s := range sf.Services {
+	for i, s := range sf.Services {
 		serv, err := parseService(s)
 		if err != nil {
-			return nil, errors.New(fmt.Sprintf("failed parsing service: %s", err))
+			return nil, errors.New(fmt.Sprintf("failed parsing service services[%d] %s: %s", i, s.Name, err))
+		}
+
+		for _, prev := range allServices {
+			if prev.Name == serv.Name {
+				return nil, fmt.Errorf("services[%d]: duplicate service name %s", i, serv.Name)
+			}
 		}
 
 		log.WithField("name", serv.Name).Debug("Loaded service configuration")
@@ -101,9 +113,45 @@ func parseService(s serviceFile) (services.Service, error) {
 		return services.Service{}, errors.New(fmt.Sprintf("failed to parse access type: %s", err))
 	}
 
+	// Parse posture requirements
+	serv.Posture, err = posture.ParseRequirements(s.Posture)
+	if err != nil {
+		return services.Service{}, err
+	}
+
+	// Parse policy rules
+	serv.Rules, err = parsePolicyRules(s.Policy)
+	if err != nil {
+		return services.Service{}, errors.New(fmt.Sprintf("bad field policy: %s", err))
+	}
+
 	return serv, nil
 }
 
+// Parses the policy rules, each a single allow or deny entry
+func parsePolicyRules(entries []map[string]string) ([]policy.Rule, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	rules := make([]policy.Rule, 0, len(entries))
+	for _, entry := range entries {
+		if len(entry) != 1 {
+			return nil, errors.New("rule needs to be either allow or deny")
+		}
+
+		for effect, expr := range entry {
+			r, err := policy.ParseRule(effect, expr)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, nil
+}
+
 // Parses a list of strings into a slice of net.IP's
 func parseIps(ipsStr []string) ([]net.IP, error) {
 	ips := make([]net.IP, 0, len(ipsStr))
@@ -0,0 +1,524 @@
+package configsyaml
+
+import (
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/policy"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A problem found in a config file
+type Problem struct {
+	File string
+	// Line of the offending value, 0 if unknown
+	Line int
+	// Path of the offending value, eg. clients[3].services[1].name
+	Path string
+	Msg  string
+	// Warnings (eg. unused services) are not errors
+	Warning bool
+}
+
+// Formats the problem as file:line: path: message
+func (p Problem) String() string {
+	s := p.File
+	if p.Line > 0 {
+		s += fmt.Sprintf(":%d", p.Line)
+	}
+	if p.Warning {
+		s += ": warning"
+	}
+	if p.Path != "" {
+		s += ": " + p.Path
+	}
+	return s + ": " + p.Msg
+}
+
+// Checks the services and clients files, reporting all problems instead of
+// stopping at the first one. Device IDs are validated using parseDeviceId,
+// if nil they have to be UUIDs. Problems are sorted by file and line.
+func Validate(servicesPath, clientsPath string, parseDeviceId func(string) (string, error)) []Problem {
+	if parseDeviceId == nil {
+		parseDeviceId = parseUUID
+	}
+
+	sv := &validator{file: servicesPath}
+	srvs := sv.servicesFile()
+
+	cv := &validator{file: clientsPath}
+	cv.clientsFile(srvs, parseDeviceId)
+
+	// Services given to no device can only be detected once the clients are
+	// known
+	if srvs != nil {
+		for _, name := range srvs.order {
+			srv := srvs.byName[name]
+			if !srvs.used[name] && !srv.allowRule {
+				sv.warnf(srv.node, srv.path, "service %s is not listed for any client nor allowed by a policy rule", name)
+			}
+		}
+	}
+
+	return append(sv.sorted(), cv.sorted()...)
+}
+
+type validator struct {
+	file     string
+	problems []Problem
+	// Unknown fields found, also part of problems
+	unknown []Problem
+}
+
+// Services found while validating the services file
+type validatedServices struct {
+	byName map[string]validatedService
+	// Names in file order
+	order []string
+	// Names listed by clients
+	used map[string]bool
+}
+
+type validatedService struct {
+	node *yaml.Node
+	path string
+	// The service has an allow rule and may be given to unlisted devices
+	allowRule bool
+}
+
+// Returns the problems sorted by line
+func (v *validator) sorted() []Problem {
+	sort.SliceStable(v.problems, func(i, j int) bool { return v.problems[i].Line < v.problems[j].Line })
+	return v.problems
+}
+
+func (v *validator) errorf(n *yaml.Node, path, format string, args ...interface{}) {
+	v.add(n, path, false, format, args...)
+}
+
+func (v *validator) warnf(n *yaml.Node, path, format string, args ...interface{}) {
+	v.add(n, path, true, format, args...)
+}
+
+func (v *validator) add(n *yaml.Node, path string, warning bool, format string, args ...interface{}) {
+	p := Problem{File: v.file, Path: path, Msg: fmt.Sprintf(format, args...), Warning: warning}
+	if n != nil {
+		p.Line = n.Line
+	}
+	v.problems = append(v.problems, p)
+}
+
+// Reads and parses the file, returning its root node or nil on failure
+func (v *validator) read() *yaml.Node {
+	data, err := ioutil.ReadFile(v.file)
+	if err != nil {
+		v.errorf(nil, "", "%s", err)
+		return nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		v.errorf(nil, "", "%s", strings.TrimPrefix(err.Error(), "yaml: "))
+		return nil
+	}
+
+	if len(doc.Content) == 0 {
+		v.errorf(nil, "", "empty file")
+		return nil
+	}
+	return doc.Content[0]
+}
+
+// Returns the values of the mapping by key. Reports keys that are not fields
+// of the struct the mapping is parsed into and duplicate keys.
+func (v *validator) fields(n *yaml.Node, path string, known map[string]bool) map[string]*yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		v.errorf(n, path, "expected a mapping")
+		return nil
+	}
+
+	m := make(map[string]*yaml.Node, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		p := joinPath(path, key.Value)
+
+		if !known[key.Value] {
+			msg := "unknown field " + key.Value
+			if s := closest(key.Value, known); s != "" {
+				msg += ", did you mean " + s + "?"
+			}
+			v.errorf(key, p, "%s", msg)
+			v.unknown = append(v.unknown, v.problems[len(v.problems)-1])
+			continue
+		}
+		if _, ok := m[key.Value]; ok {
+			v.errorf(key, p, "duplicate field %s", key.Value)
+			continue
+		}
+		m[key.Value] = value
+	}
+	return m
+}
+
+// Returns the scalar's value, reporting other nodes
+func (v *validator) scalar(n *yaml.Node, path string) (string, bool) {
+	if n.Kind != yaml.ScalarNode {
+		v.errorf(n, path, "expected a value")
+		return "", false
+	}
+	return n.Value, true
+}
+
+// Returns the sequence's items, reporting other nodes
+func (v *validator) sequence(n *yaml.Node, path string) []*yaml.Node {
+	if n.Kind != yaml.SequenceNode {
+		v.errorf(n, path, "expected a list")
+		return nil
+	}
+	return n.Content
+}
+
+// Returns the value of the required field, reporting it if missing
+func (v *validator) required(fields map[string]*yaml.Node, n *yaml.Node, path, name string) (*yaml.Node, bool) {
+	value, ok := fields[name]
+	if !ok {
+		v.errorf(n, path, "missing field %s", name)
+	}
+	return value, ok
+}
+
+// Checks the version and kind fields of the file's root mapping
+func (v *validator) header(fields map[string]*yaml.Node, root *yaml.Node, kind string) {
+	if n, ok := fields["version"]; !ok {
+		v.errorf(root, "", "%s", checkVersion(""))
+	} else if s, ok := v.scalar(n, "version"); ok {
+		if err := checkVersion(s); err != nil {
+			v.errorf(n, "version", "%s", err)
+		} else if s != SchemaVersion {
+			v.warnf(n, "version", "old schema version %s, upgrade the file to %s using migrate-config", s, SchemaVersion)
+		}
+	}
+
+	n, ok := v.required(fields, root, "", "kind")
+	if !ok {
+		return
+	}
+	if s, ok := v.scalar(n, "kind"); ok && s != kind {
+		v.errorf(n, "kind", "file not kind %s", kind)
+	}
+}
+
+func (v *validator) servicesFile() *validatedServices {
+	root := v.read()
+	if root == nil {
+		return nil
+	}
+
+	top := v.fields(root, "", knownFields(servicesFile{}))
+	if top == nil {
+		return nil
+	}
+	v.header(top, root, "services")
+
+	srvs := &validatedServices{byName: map[string]validatedService{}, used: map[string]bool{}}
+	n, ok := v.required(top, root, "", "services")
+	if !ok {
+		return srvs
+	}
+
+	for i, sn := range v.sequence(n, "services") {
+		v.service(sn, fmt.Sprintf("services[%d]", i), srvs)
+	}
+	return srvs
+}
+
+func (v *validator) service(n *yaml.Node, path string, srvs *validatedServices) {
+	f := v.fields(n, path, knownFields(serviceFile{}))
+	if f == nil {
+		return
+	}
+
+	srv := validatedService{node: n, path: path}
+
+	// Name of the service, empty if missing or a duplicate
+	var name string
+	if nn, ok := v.required(f, n, path, "name"); ok {
+		if s, ok := v.scalar(nn, path+".name"); ok {
+			if prev, dup := srvs.byName[s]; dup {
+				v.errorf(nn, path+".name", "duplicate service name %s, first defined on line %d", s, prev.node.Line)
+			} else {
+				name = s
+				srv.node = nn
+			}
+		}
+	}
+
+	if ip, ok := v.required(f, n, path, "ip"); ok {
+		if s, ok := v.scalar(ip, path+".ip"); ok && net.ParseIP(s) == nil {
+			v.errorf(ip, path+".ip", "bad ip %s, must be an ip and not a domain", s)
+		}
+	}
+
+	if pns, ok := v.required(f, n, path, "ports"); ok {
+		items := v.sequence(pns, path+".ports")
+		if pns.Kind == yaml.SequenceNode && len(items) == 0 {
+			v.errorf(pns, path+".ports", "no ports")
+		}
+		for i, pn := range items {
+			p := fmt.Sprintf("%s.ports[%d]", path, i)
+			var pp ports
+			for _, vn := range v.sequence(pn, p) {
+				s, _ := v.scalar(vn, p)
+				pp = append(pp, s)
+			}
+			if pn.Kind != yaml.SequenceNode {
+				continue
+			}
+			if _, err := parseProtocolAndPort([]ports{pp}); err != nil {
+				v.errorf(pn, p, "%s", err)
+			}
+		}
+	}
+
+	if tags, ok := f["tags"]; ok {
+		for i, tn := range v.sequence(tags, path+".tags") {
+			v.scalar(tn, fmt.Sprintf("%s.tags[%d]", path, i))
+		}
+	}
+
+	if ats, ok := v.required(f, n, path, "accessType"); ok {
+		for i, an := range v.sequence(ats, path+".accessType") {
+			p := fmt.Sprintf("%s.accessType[%d]", path, i)
+			if s, ok := v.scalar(an, p); ok {
+				if _, err := parseAccessTypes([]string{s}); err != nil {
+					v.errorf(an, p, "unknown access type %s", s)
+				}
+			}
+		}
+	}
+
+	if conds, ok := f["posture"]; ok {
+		if conds.Kind != yaml.MappingNode {
+			v.errorf(conds, path+".posture", "expected a mapping")
+		} else {
+			for i := 0; i+1 < len(conds.Content); i += 2 {
+				fact, cond := conds.Content[i].Value, conds.Content[i+1]
+				p := path + ".posture." + fact
+				if s, ok := v.scalar(cond, p); ok {
+					if _, err := posture.ParseRequirement(fact, s); err != nil {
+						v.errorf(cond, p, "%s", err)
+					}
+				}
+			}
+		}
+	}
+
+	if rules, ok := f["policy"]; ok {
+		for i, rn := range v.sequence(rules, path+".policy") {
+			p := fmt.Sprintf("%s.policy[%d]", path, i)
+			if rn.Kind != yaml.MappingNode || len(rn.Content) != 2 {
+				v.errorf(rn, p, "rule needs to be either allow or deny")
+				continue
+			}
+
+			effect, expr := rn.Content[0].Value, rn.Content[1]
+			if s, ok := v.scalar(expr, p+"."+effect); ok {
+				if _, err := policy.ParseRule(effect, s); err != nil {
+					v.errorf(expr, p+"."+effect, "%s", err)
+				} else if effect == policy.EffectAllow {
+					srv.allowRule = true
+				}
+			}
+		}
+	}
+
+	if name != "" {
+		srvs.byName[name] = srv
+		srvs.order = append(srvs.order, name)
+	}
+}
+
+// Checks the clients file. Service names are only checked if the services
+// file could be read.
+func (v *validator) clientsFile(srvs *validatedServices, parseDeviceId func(string) (string, error)) {
+	root := v.read()
+	if root == nil {
+		return
+	}
+
+	top := v.fields(root, "", knownFields(clientsFile{}))
+	if top == nil {
+		return
+	}
+	v.header(top, root, "clients")
+
+	n, ok := v.required(top, root, "", "clients")
+	if !ok {
+		return
+	}
+
+	// Lines of the device IDs, to report duplicates
+	deviceIds := map[string]int{}
+	for i, cn := range v.sequence(n, "clients") {
+		v.client(cn, fmt.Sprintf("clients[%d]", i), srvs, parseDeviceId, deviceIds)
+	}
+}
+
+func (v *validator) client(n *yaml.Node, path string, srvs *validatedServices,
+	parseDeviceId func(string) (string, error), deviceIds map[string]int) {
+
+	f := v.fields(n, path, knownFields(clientFile{}))
+	if f == nil {
+		return
+	}
+
+	if idn, ok := v.required(f, n, path, "deviceId"); ok {
+		p := path + ".deviceId"
+		if s, ok := v.scalar(idn, p); ok {
+			id, err := parseDeviceId(s)
+			switch {
+			case err != nil:
+				v.errorf(idn, p, "bad device id %s: %s", s, err)
+			case deviceIds[id] > 0:
+				v.errorf(idn, p, "duplicate device id %s, first defined on line %d", id, deviceIds[id])
+			default:
+				deviceIds[id] = idn.Line
+			}
+		}
+	}
+
+	if label, ok := f["label"]; ok {
+		v.scalar(label, path+".label")
+	}
+
+	if groups, ok := f["groups"]; ok {
+		for i, gn := range v.sequence(groups, path+".groups") {
+			v.scalar(gn, fmt.Sprintf("%s.groups[%d]", path, i))
+		}
+	}
+
+	if sn, ok := f["certSerial"]; ok {
+		if s, ok := v.scalar(sn, path+".certSerial"); ok {
+			if _, err := clients.ParseSerial(s); err != nil {
+				v.errorf(sn, path+".certSerial", "%s", err)
+			}
+		}
+	}
+
+	if fn, ok := f["certFingerprint"]; ok {
+		if s, ok := v.scalar(fn, path+".certFingerprint"); ok {
+			if _, err := clients.ParseFingerprint(s); err != nil {
+				v.errorf(fn, path+".certFingerprint", "%s", err)
+			}
+		}
+	}
+
+	list, ok := f["services"]
+	if !ok {
+		return
+	}
+
+	listed := map[string]bool{}
+	for i, spn := range v.sequence(list, path+".services") {
+		p := fmt.Sprintf("%s.services[%d]", path, i)
+		spf := v.fields(spn, p, knownFields(clientFileServicePolicy{}))
+		if spf == nil {
+			continue
+		}
+
+		name, ok := v.required(spf, spn, p, "name")
+		if !ok {
+			continue
+		}
+		s, ok := v.scalar(name, p+".name")
+		if !ok {
+			continue
+		}
+
+		if listed[s] {
+			v.warnf(name, p+".name", "service %s listed more than once", s)
+		}
+		listed[s] = true
+
+		if srvs == nil {
+			continue
+		}
+		if _, ok := srvs.byName[s]; !ok {
+			v.errorf(name, p+".name", "non-existing service %s", s)
+			continue
+		}
+		srvs.used[s] = true
+	}
+}
+
+// Returns the known field at most two edits away from the name, if any, to
+// suggest for typos such as accesType
+func closest(name string, known map[string]bool) string {
+	best, bestDist := "", 3
+	for k := range known {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(k)); d < bestDist || (d == bestDist && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// Levenshtein distance of the strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Returns the YAML keys of the struct's fields, as used by yaml.v2: the
+// yaml tag if set, otherwise the lowercased field name.
+func knownFields(v interface{}) map[string]bool {
+	t := reflect.TypeOf(v)
+	known := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		known[name] = true
+	}
+	return known
+}
@@ -0,0 +1,134 @@
+package configsyaml
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testServices = `version: 0.2.0
+kind: services
+services:
+- name: example-www
+  ip: 192.168.1.1
+  ports:
+  - [tcp, 80]
+  accessType: [OpenSPA]
+- name: example-ssh
+  ip: 192.168.1.1
+  ports:
+  - [tcp, 22]
+  accessType: [OpenSPA]
+  posture:
+    os-version: ">= 22.04"
+  policy:
+  - allow: '"admins" in device.groups'
+`
+
+const testClients = `version: 0.2.0
+kind: clients
+clients:
+- deviceId: 9f84fbb8-10e8-4b8a-abd2-bb91cbf484df
+  label: alice
+  groups: [admins]
+  services:
+  - name: example-www
+`
+
+// Both the loaders and Validate have to refuse every broken file, so that
+// the server refuses what validate reports and the other way around
+var configTests = []struct {
+	name     string
+	services string
+	clients  string
+	// Substring of the problem reported by Validate, empty if valid
+	problem string
+}{
+	{"valid", testServices, testClients, ""},
+	{"duplicate service", testServices + `- name: example-www
+  ip: 192.168.1.2
+  ports: [[tcp, 80]]
+  accessType: [OpenSPA]
+`, testClients, "duplicate service name example-www"},
+	{"duplicate device", testServices, testClients + `- deviceId: 9f84fbb8-10e8-4b8a-abd2-bb91cbf484df
+  services: []
+`, "duplicate device id"},
+	{"unknown field", strings.Replace(testServices, "accessType: [OpenSPA]\n- name: example-ssh",
+		"accesType: [OpenSPA]\n- name: example-ssh", 1), testClients, "unknown field accesType, did you mean accessType?"},
+	{"unknown field of old version", strings.Replace(testServices, "0.2.0", "0.1.0", 1) + "  tag: [www]\n",
+		testClients, "unknown field tag, did you mean tags?"},
+	{"non-existing service", testServices, testClients + "  - name: example-ftp\n", "non-existing service example-ftp"},
+	{"bad ip", strings.Replace(testServices, "192.168.1.1", "example.com", 1), testClients, "bad ip"},
+	{"bad port", strings.Replace(testServices, "[tcp, 80]", "[sctp, 80]", 1), testClients, "unknown protocol"},
+	{"bad posture", strings.Replace(testServices, ">= 22.04", ">= x", 1), testClients, "bad version"},
+	{"bad rule", strings.Replace(testServices, `"admins" in`, `"admins" on`, 1), testClients, "allow rule"},
+	{"bad device id", testServices, strings.Replace(testClients, "9f84fbb8", "x", 1), "bad device id"},
+	{"bad serial", testServices, testClients + "  certSerial: zz\n", "bad certificate serial"},
+	{"wrong kind", testServices, strings.Replace(testClients, "kind: clients", "kind: services", 1), "not kind clients"},
+	{"unsupported version", testServices, strings.Replace(testClients, "0.2.0", "9.0.0", 1), "unsupported version"},
+}
+
+func writeConfigs(t *testing.T, services, clients string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	servicesPath := filepath.Join(dir, "services.yaml")
+	clientsPath := filepath.Join(dir, "clients.yaml")
+	if err := ioutil.WriteFile(servicesPath, []byte(services), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clientsPath, []byte(clients), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return servicesPath, clientsPath
+}
+
+func TestValidateAgreesWithRead(t *testing.T) {
+	for _, tt := range configTests {
+		servicesPath, clientsPath := writeConfigs(t, tt.services, tt.clients)
+
+		var errs []Problem
+		for _, p := range Validate(servicesPath, clientsPath, nil) {
+			if !p.Warning {
+				errs = append(errs, p)
+			}
+		}
+
+		srvs, readErr := ServicesRead(servicesPath)
+		if readErr == nil {
+			_, readErr = ClientsRead(clientsPath, srvs, nil)
+		}
+
+		if tt.problem == "" {
+			if len(errs) > 0 || readErr != nil {
+				t.Errorf("%s: got problems %v and read error %v, want none", tt.name, errs, readErr)
+			}
+			continue
+		}
+
+		if readErr == nil {
+			t.Errorf("%s: read succeeded, want error", tt.name)
+		}
+		found := false
+		for _, p := range errs {
+			found = found || strings.Contains(p.Msg, tt.problem)
+		}
+		if !found {
+			t.Errorf("%s: problems %v, want one containing %q", tt.name, errs, tt.problem)
+		}
+	}
+}
+
+func TestValidateLines(t *testing.T) {
+	servicesPath, clientsPath := writeConfigs(t, testServices, testClients+"  - name: example-ftp\n")
+
+	problems := Validate(servicesPath, clientsPath, nil)
+	if len(problems) != 1 {
+		t.Fatalf("got problems %v, want one", problems)
+	}
+
+	want := clientsPath + ":9: clients[0].services[1].name: non-existing service example-ftp"
+	if s := problems[0].String(); s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+}
@@ -0,0 +1,72 @@
+package configsyaml
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"strings"
+)
+
+// Schema version of the services and clients files
+const SchemaVersion = "0.2.0"
+
+// Schema versions that can be read, oldest first. Files of older versions can
+// be upgraded using Migrate.
+var supportedVersions = []string{"0.1.0", SchemaVersion}
+
+// Upgrades of the schema, applied in order starting from the file's version
+var migrations = []struct {
+	from, to string
+}{
+	// 0.1.0 tolerated unknown fields, files without any only need their
+	// version bumped
+	{"0.1.0", "0.2.0"},
+}
+
+// Fields common to the services and clients files
+type fileHeader struct {
+	Version string
+	Kind    string
+}
+
+// Returns an error unless the schema version is supported
+func checkVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("missing field version, supported versions are %s", strings.Join(supportedVersions, ", "))
+	}
+
+	for _, v := range supportedVersions {
+		if v == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported version %s, supported versions are %s",
+		version, strings.Join(supportedVersions, ", "))
+}
+
+// Parses the file into v after checking its schema version. Unknown fields
+// are rejected regardless of the version, since a misspelled field would
+// otherwise silently drop eg. a certificate binding. Old versions are reported
+// by Validate.
+func unmarshalFile(data []byte, v interface{}) error {
+	h := fileHeader{}
+	if err := yaml.Unmarshal(data, &h); err != nil {
+		return err
+	}
+
+	if err := checkVersion(h.Version); err != nil {
+		return err
+	}
+
+	return strictError(yaml.UnmarshalStrict(data, v))
+}
+
+var notFoundInType = regexp.MustCompile(`field (\S+) not found in type \S+`)
+
+// Rewords the unknown field errors of strict parsing, which name Go types
+func strictError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s", notFoundInType.ReplaceAllString(err.Error(), "unknown field $1"))
+}
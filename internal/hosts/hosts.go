@@ -0,0 +1,139 @@
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	beginMarker = "# BEGIN OpenSDP managed block, do not edit"
+	endMarker   = "# END OpenSDP managed block"
+)
+
+// Hosts file with a block of entries managed by OpenSDP. Entries outside of
+// the block are left untouched.
+type File struct {
+	Path string
+	// Domain appended to service names, eg. <service>.opensdp
+	Domain string
+}
+
+// Replaces the managed block with entries for the services.
+func (f *File) Update(srvs []services.Service) error {
+	var block bytes.Buffer
+	block.WriteString(beginMarker + "\n")
+	for _, s := range srvs {
+		if s.IP == nil {
+			continue
+		}
+		fmt.Fprintf(&block, "%s\t%s\n", s.IP.String(), f.Hostname(s.Name))
+	}
+	block.WriteString(endMarker + "\n")
+
+	if err := f.write(block.Bytes()); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"hosts": f.Path,
+		"count": len(srvs),
+	}).Debug("Updated hosts file")
+	return nil
+}
+
+// Removes the managed block.
+func (f *File) Clean() error {
+	if err := f.write(nil); err != nil {
+		return err
+	}
+
+	log.WithField("hosts", f.Path).Debug("Removed managed block from hosts file")
+	return nil
+}
+
+// Returns the hostname of the service. Characters not allowed in hostnames
+// are replaced with a dash.
+func (f *File) Hostname(service string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, service)
+
+	if f.Domain == "" {
+		return name
+	}
+	return name + "." + f.Domain
+}
+
+// Writes the hosts file with the managed block replaced by block. The file is
+// written in place (instead of renaming a temporary file), since hosts files
+// are often bind mounted.
+func (f *File) write(block []byte) error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+
+	updated := replaceBlock(data, block)
+	if bytes.Equal(data, updated) {
+		return nil
+	}
+
+	return ioutil.WriteFile(f.Path, updated, info.Mode())
+}
+
+// Returns data with the managed block replaced by block. The block is
+// appended if data does not contain one.
+func replaceBlock(data, block []byte) []byte {
+	var out, pending bytes.Buffer
+	lines := strings.SplitAfter(string(data), "\n")
+
+	inBlock, replaced := false, false
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		switch {
+		case trimmed == beginMarker && !inBlock:
+			inBlock = true
+			pending.WriteString(l)
+		case trimmed == endMarker && inBlock:
+			inBlock = false
+			pending.Reset()
+			if !replaced {
+				out.Write(block)
+				replaced = true
+			}
+		case inBlock:
+			pending.WriteString(l)
+		default:
+			out.WriteString(l)
+		}
+	}
+
+	// Keep the lines of a block missing its end marker
+	out.Write(pending.Bytes())
+
+	if !replaced && len(block) > 0 {
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteString("\n")
+		}
+		out.Write(block)
+	}
+
+	return out.Bytes()
+}
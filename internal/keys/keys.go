@@ -0,0 +1,251 @@
+// Package keys loads the client's certificate and private key from PEM files
+// (optionally passphrase encrypted), PKCS#12 bundles or PKCS#11 tokens. Keys
+// are used through crypto.Signer, so keys kept on tokens never leave them.
+package keys
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"io/ioutil"
+	"os"
+	"software.sslmate.com/src/go-pkcs12"
+	"strings"
+)
+
+// Returns the passphrase of an encrypted key, PKCS#12 bundle or the PIN of a
+// PKCS#11 token. Only called when one is needed.
+type PassphraseFunc func() ([]byte, error)
+
+// PKCS#11 token and key, the token's PIN is the source's passphrase
+type PKCS11Config struct {
+	// Path of the PKCS#11 module (eg. /usr/lib/softhsm/libsofthsm2.so)
+	Module     string
+	TokenLabel string
+	// Label of the private key and, if read from the token, the certificate
+	KeyLabel string
+}
+
+// Where the client's certificate and private key are loaded from. Exactly one
+// of KeyPath, PKCS12Path and PKCS11 should be set.
+type Source struct {
+	// PEM certificate chain, not needed for PKCS#12 bundles and for PKCS#11
+	// tokens holding the certificate
+	CertPath string
+	// PEM private key: PKCS#1, SEC1, PKCS#8 or encrypted PKCS#8
+	KeyPath string
+	// PKCS#12 bundle with the certificate and private key
+	PKCS12Path string
+	// PKCS#11 token holding the private key
+	PKCS11     *PKCS11Config
+	Passphrase PassphraseFunc
+}
+
+// Loads the certificate and private key of the source.
+func (s Source) Load() (tls.Certificate, error) {
+	switch {
+	case s.PKCS11 != nil:
+		return loadPKCS11(s.CertPath, *s.PKCS11, s.Passphrase)
+	case s.PKCS12Path != "":
+		return loadPKCS12(s.PKCS12Path, s.Passphrase)
+	default:
+		signer, err := LoadPEMKey(s.KeyPath, s.Passphrase)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		return Certificate(s.CertPath, signer)
+	}
+}
+
+// Loads a PEM private key, decrypting it using the passphrase if it is an
+// encrypted PKCS#8 key.
+func LoadPEMKey(path string, passphrase PassphraseFunc) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *pem.Block
+	for {
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no private key found in %s", path)
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			break
+		}
+	}
+
+	if _, ok := block.Headers["DEK-Info"]; ok {
+		return nil, errors.New("legacy PEM encryption is not supported, convert the key to encrypted PKCS#8")
+	}
+
+	der := block.Bytes
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == nil {
+			return nil, errors.New("key is encrypted but no passphrase is available")
+		}
+
+		pass, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		if der, err = decryptPKCS8(der, pass); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := parsePrivateKey(der)
+	if err != nil {
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, ErrBadPassphrase
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Parses a DER PKCS#8, PKCS#1 or SEC1 private key
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil, errors.New("unsupported private key")
+			}
+		}
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	return signer, nil
+}
+
+// Returns the TLS certificate of the PEM certificate chain using the signer
+// as its private key. Fails if the signer does not match the certificate.
+func Certificate(certPath string, signer crypto.Signer) (tls.Certificate, error) {
+	data, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert := tls.Certificate{PrivateKey: signer}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+
+	if len(cert.Certificate) == 0 {
+		return tls.Certificate{}, fmt.Errorf("no certificate found in %s", certPath)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := matchesKey(leaf, signer); err != nil {
+		return tls.Certificate{}, err
+	}
+	cert.Leaf = leaf
+
+	return cert, nil
+}
+
+func matchesKey(leaf *x509.Certificate, signer crypto.Signer) error {
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(leaf.PublicKey) {
+		return errors.New("private key does not match the certificate")
+	}
+	return nil
+}
+
+// Loads the certificate, its chain and the private key of a PKCS#12 bundle.
+func loadPKCS12(path string, passphrase PassphraseFunc) (tls.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	// Bundles without a password are tried first
+	key, leaf, chain, err := pkcs12.DecodeChain(data, "")
+	if err == pkcs12.ErrIncorrectPassword && passphrase != nil {
+		pass, perr := passphrase()
+		if perr != nil {
+			return tls.Certificate{}, perr
+		}
+		key, leaf, chain, err = pkcs12.DecodeChain(data, string(pass))
+	}
+	if err == pkcs12.ErrIncorrectPassword {
+		return tls.Certificate{}, ErrBadPassphrase
+	}
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, errors.New("private key cannot sign")
+	}
+
+	cert := tls.Certificate{PrivateKey: signer, Leaf: leaf, Certificate: [][]byte{leaf.Raw}}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return cert, nil
+}
+
+// Returns the passphrase from the environment variable
+func PassphraseFromEnv(name string) PassphraseFunc {
+	return func() ([]byte, error) {
+		pass, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("passphrase environment variable %s not set", name)
+		}
+		return []byte(pass), nil
+	}
+}
+
+// Returns the passphrase read from the first line of the file
+func PassphraseFromFile(path string) PassphraseFunc {
+	return func() ([]byte, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")), nil
+	}
+}
+
+// Prompts for the passphrase on the terminal. The terminal is used directly,
+// so that stdin and stdout remain usable (eg. by ssh-proxy).
+func PassphrasePrompt(prompt string) PassphraseFunc {
+	return func() ([]byte, error) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return nil, errors.New("passphrase needed but no terminal to prompt on")
+		}
+		defer tty.Close()
+
+		fmt.Fprint(tty, prompt)
+		pass, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(tty)
+		return pass, err
+	}
+}
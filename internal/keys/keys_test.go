@@ -0,0 +1,133 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Fixtures are generated by testdata/generate.sh
+const testPassphrase = "correct horse battery staple"
+
+func passphrase(s string) PassphraseFunc {
+	return func() ([]byte, error) { return []byte(s), nil }
+}
+
+func testdata(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+func TestLoadPEMKey(t *testing.T) {
+	want, err := LoadPEMKey(testdata("client.key"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"client-aes256-sha256.key", "client-aes128-sha1.key", "client-aes192-sha512.key"} {
+		key, err := LoadPEMKey(testdata(name), passphrase(testPassphrase))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(want.Public()) {
+			t.Errorf("%s: decrypted key differs from client.key", name)
+		}
+
+		if _, err := LoadPEMKey(testdata(name), passphrase("wrong")); err != ErrBadPassphrase {
+			t.Errorf("%s with wrong passphrase: got %v, want ErrBadPassphrase", name, err)
+		}
+
+		if _, err := LoadPEMKey(testdata(name), nil); err == nil {
+			t.Errorf("%s without passphrase: got no error", name)
+		}
+	}
+}
+
+func TestLoadPEMKeyUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"client-pbes1.key", "only PBES2 is supported"},
+		{"client-des3.key", "only AES-CBC is supported"},
+		{"client-legacy.key", "legacy PEM encryption is not supported"},
+		{"client.crt", "no private key found"},
+	}
+
+	for _, tt := range tests {
+		_, err := LoadPEMKey(testdata(tt.name), passphrase(testPassphrase))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecryptPKCS8Malformed(t *testing.T) {
+	if _, err := decryptPKCS8([]byte("not der"), []byte(testPassphrase)); err == nil {
+		t.Error("got no error for malformed input")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	want, err := tls.LoadX509KeyPair(testdata("client.crt"), testdata("client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		src  Source
+		err  error
+	}{
+		{"pem", Source{CertPath: testdata("client.crt"), KeyPath: testdata("client.key")}, nil},
+		{"encrypted pem", Source{CertPath: testdata("client.crt"), KeyPath: testdata("client-aes256-sha256.key"),
+			Passphrase: passphrase(testPassphrase)}, nil},
+		{"encrypted pem with wrong passphrase", Source{CertPath: testdata("client.crt"),
+			KeyPath: testdata("client-aes256-sha256.key"), Passphrase: passphrase("wrong")}, ErrBadPassphrase},
+		{"pkcs12", Source{PKCS12Path: testdata("client.p12"), Passphrase: passphrase(testPassphrase)}, nil},
+		{"pkcs12 with wrong passphrase", Source{PKCS12Path: testdata("client.p12"), Passphrase: passphrase("wrong")},
+			ErrBadPassphrase},
+		{"pkcs12 without passphrase", Source{PKCS12Path: testdata("client-nopass.p12")}, nil},
+	}
+
+	for _, tt := range tests {
+		cert, err := tt.src.Load()
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if len(cert.Certificate) == 0 || string(cert.Certificate[0]) != string(want.Certificate[0]) {
+			t.Errorf("%s: loaded certificate differs from client.crt", tt.name)
+		}
+		if cert.Leaf == nil {
+			t.Errorf("%s: leaf not set", tt.name)
+		}
+	}
+}
+
+func TestLoadMismatchedKey(t *testing.T) {
+	src := Source{CertPath: testdata("client.crt"), KeyPath: testdata("other.key")}
+	if _, err := src.Load(); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("got %v, want key mismatch", err)
+	}
+}
+
+func TestPassphraseFromFile(t *testing.T) {
+	pass, err := PassphraseFromFile(testdata("passphrase.txt"))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pass) != testPassphrase {
+		t.Errorf("got %q, want %q", pass, testPassphrase)
+	}
+}
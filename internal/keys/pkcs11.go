@@ -0,0 +1,58 @@
+//go:build pkcs11
+
+package keys
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/ThalesGroup/crypto11"
+)
+
+// Loads the private key from the PKCS#11 token. The key is used for signing
+// on the token only. The certificate is read from certPath, or from the token
+// if certPath is empty.
+func loadPKCS11(certPath string, cfg PKCS11Config, pin PassphraseFunc) (tls.Certificate, error) {
+	if pin == nil {
+		return tls.Certificate{}, errors.New("pkcs11 token pin needed but no passphrase is available")
+	}
+
+	p, err := pin()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       cfg.Module,
+		TokenLabel: cfg.TokenLabel,
+		Pin:        string(p),
+	})
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	signer, err := ctx.FindKeyPair(nil, []byte(cfg.KeyLabel))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if signer == nil {
+		return tls.Certificate{}, errors.New("key " + cfg.KeyLabel + " not found on the pkcs11 token")
+	}
+
+	if certPath != "" {
+		return Certificate(certPath, signer)
+	}
+
+	leaf, err := ctx.FindCertificate(nil, []byte(cfg.KeyLabel), nil)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if leaf == nil {
+		return tls.Certificate{}, errors.New("certificate " + cfg.KeyLabel + " not found on the pkcs11 token")
+	}
+
+	if err := matchesKey(leaf, signer); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: signer, Leaf: leaf}, nil
+}
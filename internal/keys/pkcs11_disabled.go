@@ -0,0 +1,12 @@
+//go:build !pkcs11
+
+package keys
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+func loadPKCS11(certPath string, cfg PKCS11Config, pin PassphraseFunc) (tls.Certificate, error) {
+	return tls.Certificate{}, errors.New("built without pkcs11 support, rebuild using -tags pkcs11")
+}
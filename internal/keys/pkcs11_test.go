@@ -0,0 +1,144 @@
+//go:build pkcs11
+
+package keys
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/ThalesGroup/crypto11"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPIN = "1234"
+
+// Modules tried unless SOFTHSM2_MODULE is set
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// Initializes a SoftHSM token in a temporary directory holding a generated key
+// and its certificate, both labeled "client". Returns the token's config and
+// the path of the certificate as PEM. Skips the test without SoftHSM.
+func softHSM(t *testing.T) (PKCS11Config, string) {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	for _, m := range softHSMModules {
+		if _, err := os.Stat(m); module == "" && err == nil {
+			module = m
+		}
+	}
+	util, err := exec.LookPath("softhsm2-util")
+	if module == "" || err != nil {
+		t.Skip("SoftHSM not installed")
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	cfg := PKCS11Config{Module: module, TokenLabel: "opensdp-test", KeyLabel: "client"}
+	out, err := exec.Command(util, "--init-token", "--free", "--label", cfg.TokenLabel,
+		"--pin", testPIN, "--so-pin", "123456").CombinedOutput()
+	if err != nil {
+		t.Fatalf("softhsm2-util: %s: %s", err, out)
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{Path: module, TokenLabel: cfg.TokenLabel, Pin: testPIN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+
+	signer, err := ctx.GenerateECDSAKeyPairWithLabel([]byte{1}, []byte(cfg.KeyLabel), elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "9f84fbb8-10e8-4b8a-abd2-bb91cbf484df"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, signer.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.ImportCertificateWithLabel([]byte{1}, []byte(cfg.KeyLabel), cert); err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, "client.crt")
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg, certPath
+}
+
+// A single token is used, since modules stay loaded by the keys loaded from
+// them. The errors are checked first, since PKCS#11 logins are shared by all
+// sessions and a wrong PIN would pass once logged in.
+func TestLoadPKCS11(t *testing.T) {
+	cfg, certPath := softHSM(t)
+
+	unknownKey := cfg
+	unknownKey.KeyLabel = "unknown"
+
+	tests := []struct {
+		name string
+		src  Source
+		err  string
+	}{
+		{"wrong pin", Source{PKCS11: &cfg, Passphrase: passphrase("0000")}, ""},
+		{"no pin", Source{PKCS11: &cfg}, "no passphrase is available"},
+		{"unknown key", Source{PKCS11: &unknownKey, Passphrase: passphrase(testPIN)}, "not found on the pkcs11 token"},
+		{"other certificate", Source{CertPath: testdata("client.crt"), PKCS11: &cfg, Passphrase: passphrase(testPIN)},
+			"does not match"},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.src.Load()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.err)
+		}
+	}
+
+	for _, path := range []string{"", certPath} {
+		cert, err := Source{CertPath: path, PKCS11: &cfg, Passphrase: passphrase(testPIN)}.Load()
+		if err != nil {
+			t.Fatalf("certificate %q: %s", path, err)
+		}
+
+		signer, ok := cert.PrivateKey.(crypto11.Signer)
+		if !ok {
+			t.Fatalf("certificate %q: key is not on the token", path)
+		}
+		if err := matchesKey(cert.Leaf, signer); err != nil {
+			t.Errorf("certificate %q: %s", path, err)
+		}
+	}
+}
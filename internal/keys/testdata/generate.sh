@@ -0,0 +1,24 @@
+#!/bin/sh
+# Generates the key fixtures of the keys tests using openssl. The encrypted
+# keys and bundles use the passphrase in passphrase.txt.
+set -e
+cd "$(dirname "$0")"
+
+pass="file:passphrase.txt"
+
+openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out client.key
+openssl req -new -x509 -key client.key -subj "/CN=9f84fbb8-10e8-4b8a-abd2-bb91cbf484df" -days 36500 -out client.crt
+openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out other.key
+
+# PBES2 with the supported PBKDF2 PRFs and AES-CBC key sizes
+openssl pkcs8 -topk8 -in client.key -v2 aes-256-cbc -v2prf hmacWithSHA256 -passout $pass -out client-aes256-sha256.key
+openssl pkcs8 -topk8 -in client.key -v2 aes-128-cbc -v2prf hmacWithSHA1 -passout $pass -out client-aes128-sha1.key
+openssl pkcs8 -topk8 -in client.key -v2 aes-192-cbc -v2prf hmacWithSHA512 -passout $pass -out client-aes192-sha512.key
+
+# Unsupported encryptions
+openssl pkcs8 -topk8 -in client.key -v1 PBE-SHA1-3DES -passout $pass -out client-pbes1.key
+openssl pkcs8 -topk8 -in client.key -v2 des3 -passout $pass -out client-des3.key
+openssl ec -in client.key -aes256 -passout $pass -out client-legacy.key
+
+openssl pkcs12 -export -in client.crt -inkey client.key -passout $pass -out client.p12
+openssl pkcs12 -export -in client.crt -inkey client.key -passout pass: -out client-nopass.p12
@@ -10,6 +10,9 @@ import (
 	"strings"
 )
 
+// Where the output of the OpenSPA client is written to
+var Output io.Writer = os.Stdout
+
 type Client struct {
 	Cmd    string
 	OSPA   string
@@ -23,7 +26,22 @@ type Request struct {
 	EndPort   uint16
 }
 
+// Sends the OpenSPA request and waits for the OpenSPA client to exit. In
+// continuous mode the client keeps renewing the request and does not exit
+// on its own.
 func (c *Client) Send(req Request, continuous bool) error {
+	cmd, err := c.Start(req, continuous)
+	if err != nil {
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+// Starts the OpenSPA client for the request without waiting for it to exit.
+// The caller is responsible for calling Wait (and optionally killing the
+// process beforehand) on the returned command.
+func (c *Client) Start(req Request, continuous bool) (*exec.Cmd, error) {
 
 	sPort := strconv.Itoa(int(req.StartPort))
 	ePort := strconv.Itoa(int(req.EndPort))
@@ -39,27 +57,14 @@ func (c *Client) Send(req Request, continuous bool) error {
 	log.WithField("command", strings.Join(cmdStr, " ")).Debug("OpenSPA command")
 
 	cmd := exec.Command(cmdStr[0], cmdStr[1:]...)
-
-	// Get stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
-	}
+	cmd.Stdout = Output
+	cmd.Stderr = os.Stderr
 
 	// Start the command
-	err = cmd.Start()
+	err := cmd.Start()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer cmd.Wait()
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stderr, stderr)
-
-	return nil
+	return cmd, nil
 }
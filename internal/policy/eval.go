@@ -0,0 +1,316 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Attributes of a request the expressions are evaluated against, by name.
+// Values are strings, float64 numbers, bools, lists ([]string or
+// []interface{}) or nested attributes (Attributes or map[string]string).
+type Attributes map[string]interface{}
+
+// Functions callable from expressions
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"startsWith": func(args []interface{}) (interface{}, error) {
+		s, prefix, err := stringArgs("startsWith", args)
+		return err == nil && strings.HasPrefix(s, prefix), err
+	},
+	"endsWith": func(args []interface{}) (interface{}, error) {
+		s, suffix, err := stringArgs("endsWith", args)
+		return err == nil && strings.HasSuffix(s, suffix), err
+	},
+}
+
+func stringArgs(name string, args []interface{}) (string, string, error) {
+	if len(args) != 2 {
+		return "", "", fmt.Errorf("%s expects 2 arguments", name)
+	}
+	a, ok1 := args[0].(string)
+	b, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return "", "", fmt.Errorf("%s expects strings", name)
+	}
+	return a, b, nil
+}
+
+func (n *literal) eval(attrs Attributes) (interface{}, error) {
+	return n.value, nil
+}
+
+// Missing attributes evaluate to null, which only comparisons with the null
+// literal accept
+func (n *path) eval(attrs Attributes) (interface{}, error) {
+	var cur interface{} = attrs
+	for _, name := range n.names {
+		switch m := cur.(type) {
+		case Attributes:
+			cur = m[name]
+		case map[string]interface{}:
+			cur = m[name]
+		case map[string]string:
+			if v, ok := m[name]; ok {
+				cur = v
+			} else {
+				cur = nil
+			}
+		default:
+			return nil, nil
+		}
+	}
+	return cur, nil
+}
+
+func (n *list) eval(attrs Attributes) (interface{}, error) {
+	items := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		if err := requireValue(item, v, "list"); err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (n *not) eval(attrs Attributes) (interface{}, error) {
+	v, err := n.operand.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireValue(n.operand, v, "!"); err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+func (n *call) eval(attrs Attributes) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, a := range n.args {
+		v, err := a.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		if err := requireValue(a, v, n.name); err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return functions[n.name](args)
+}
+
+func (n *binary) eval(attrs Attributes) (interface{}, error) {
+	left, err := n.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing attributes fail everywhere but in comparisons with null, so
+	// that a device cannot escape a deny rule (or match an allow rule such as
+	// !posture.jailbroken) by leaving out a posture fact
+	nullCompare := (n.op == "==" || n.op == "!=") && (isNull(n.left) || isNull(n.right))
+	if !nullCompare {
+		if err := requireValue(n.left, left, n.op); err != nil {
+			return nil, err
+		}
+	}
+
+	// Short-circuit the logical operators
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+	}
+
+	right, err := n.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if !nullCompare {
+		if err := requireValue(n.right, right, n.op); err != nil {
+			return nil, err
+		}
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return truthy(right), nil
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return in(left, right)
+	default:
+		return compare(n.op, left, right)
+	}
+}
+
+// Returns an error if the operand of op is null, naming the missing attribute
+func requireValue(operand node, v interface{}, op string) error {
+	if v != nil {
+		return nil
+	}
+	if p, ok := operand.(*path); ok {
+		return fmt.Errorf("missing attribute %s in %s", strings.Join(p.names, "."), op)
+	}
+	return fmt.Errorf("null operand of %s", op)
+}
+
+// Returns true for the null literal
+func isNull(n node) bool {
+	l, ok := n.(*literal)
+	return ok && l.value == nil
+}
+
+// Returns true for true and "true", posture facts are strings
+func truthy(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	default:
+		return false
+	}
+}
+
+// Compares scalars. Strings equal bools and numbers they represent, so that
+// eg. posture.firewall == true holds for the fact "true".
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch x := a.(type) {
+	case string:
+		switch y := b.(type) {
+		case string:
+			return x == y
+		case bool:
+			return x == strconv.FormatBool(y)
+		case float64:
+			f, err := strconv.ParseFloat(x, 64)
+			return err == nil && f == y
+		}
+	case bool:
+		switch y := b.(type) {
+		case bool:
+			return x == y
+		case string:
+			return equal(y, x)
+		}
+	case float64:
+		switch y := b.(type) {
+		case float64:
+			return x == y
+		case string:
+			return equal(y, x)
+		}
+	}
+	return false
+}
+
+// Membership in a list, or of an IP in a CIDR range (or a list of ranges)
+func in(a, b interface{}) (interface{}, error) {
+	switch items := b.(type) {
+	case []interface{}:
+		for _, item := range items {
+			if equal(a, item) || inCIDR(a, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case []string:
+		for _, item := range items {
+			if equal(a, item) || inCIDR(a, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		if _, _, err := net.ParseCIDR(items); err != nil {
+			return nil, fmt.Errorf("in expects a list or cidr range, got %q", items)
+		}
+		return inCIDR(a, items), nil
+	default:
+		return nil, fmt.Errorf("in expects a list or cidr range")
+	}
+}
+
+func inCIDR(ip, cidr interface{}) bool {
+	ipStr, ok1 := ip.(string)
+	cidrStr, ok2 := cidr.(string)
+	if !ok1 || !ok2 || !strings.Contains(cidrStr, "/") {
+		return false
+	}
+
+	_, network, err := net.ParseCIDR(cidrStr)
+	parsed := net.ParseIP(ipStr)
+	return err == nil && parsed != nil && network.Contains(parsed)
+}
+
+// Orders strings as dotted versions if both are versions (eg. os-version >=
+// "22.04"), numbers numerically and other strings lexically
+func compare(op string, a, b interface{}) (interface{}, error) {
+	var c int
+	x, xNum := number(a)
+	y, yNum := number(b)
+	aStr, aIsStr := a.(string)
+	bStr, bIsStr := b.(string)
+
+	var versionErr error
+	if aIsStr && bIsStr {
+		c, versionErr = posture.CompareVersions(aStr, bStr)
+	}
+
+	switch {
+	case aIsStr && bIsStr && versionErr == nil:
+	case xNum && yNum:
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	case aIsStr && bIsStr:
+		c = strings.Compare(aStr, bStr)
+	default:
+		return nil, fmt.Errorf("cannot compare %v %s %v", a, op, b)
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// Returns the value as a number, numeric strings included
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
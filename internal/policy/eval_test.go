@@ -0,0 +1,201 @@
+package policy
+
+import "testing"
+
+var testAttrs = Attributes{
+	"device": Attributes{
+		"id":     "9f84fbb8-10e8-4b8a-abd2-bb91cbf484df",
+		"groups": []string{"admins", "dev"},
+	},
+	"peer": Attributes{"ip": "10.1.2.3"},
+	"time": Attributes{"hour": 9.0, "weekday": "monday"},
+	"posture": map[string]string{
+		"os-version":      "22.10",
+		"agent-version":   "8",
+		"firewall":        "true",
+		"disk-encryption": "false",
+	},
+}
+
+func eval(t *testing.T, src string, attrs Attributes) (bool, error) {
+	t.Helper()
+	e, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q) failed: %s", src, err)
+	}
+	return e.Eval(attrs)
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`device.id == "9f84fbb8-10e8-4b8a-abd2-bb91cbf484df"`, true},
+		{`device.id != "x"`, true},
+		{`"admins" in device.groups`, true},
+		{`"ops" in device.groups`, false},
+		{`peer.ip in "10.0.0.0/8"`, true},
+		{`peer.ip in ["192.168.0.0/16", "10.1.2.3"]`, true},
+		{`peer.ip in ["192.168.0.0/16"]`, false},
+		{`time.hour >= 8 && time.hour < 17`, true},
+		{`time.weekday in ["saturday", "sunday"]`, false},
+		// Versions compare by their parts, not lexically
+		{`posture.os-version >= "22.04"`, true},
+		{`posture.os-version < "22.9"`, false},
+		{`posture.agent-version < "10"`, true},
+		// Facts are strings, bools and numbers compare by their meaning
+		{`posture.firewall == true`, true},
+		{`posture["disk-encryption"] == false`, true},
+		{`posture.firewall`, true},
+		{`!posture.disk-encryption`, true},
+		{`!posture.firewall`, false},
+		{`posture.agent-version == 8`, true},
+		// Missing attributes only compare to null
+		{`posture.missing == null`, true},
+		{`null != posture.missing`, false},
+		{`posture.firewall != null`, true},
+		{`startsWith(device.id, "9f84")`, true},
+		{`endsWith(posture.os-version, ".04")`, false},
+		// Short-circuiting skips the missing attribute
+		{`false && posture.missing < "1"`, false},
+		{`true || posture.missing < "1"`, true},
+	}
+
+	for _, tt := range tests {
+		got, err := eval(t, tt.src, testAttrs)
+		if err != nil {
+			t.Errorf("%s failed: %s", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %t, want %t", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, src := range []string{
+		// Missing attributes
+		`posture.os-version-x < "13"`,
+		`"13" > posture.missing`,
+		`peer.port in [22]`,
+		`"admins" in device.missing`,
+		`startsWith(device.label, "a")`,
+		`!(posture.missing >= "1")`,
+		`posture.missing != "x"`,
+		`posture.missing == false`,
+		`!posture.missing`,
+		`posture.missing`,
+		`posture.missing && true`,
+		`posture.missing || true`,
+		`true && posture.missing`,
+		`device.id in [posture.missing]`,
+		// Mismatched types
+		`peer.ip > 3`,
+		`device.id in 3`,
+		`device.id in "not a cidr"`,
+		`startsWith(time.hour, "9")`,
+	} {
+		if _, err := eval(t, src, testAttrs); err == nil {
+			t.Errorf("%s succeeded, want error", src)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	rule := func(effect, src string) Rule {
+		r, err := ParseRule(effect, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	rules := []Rule{
+		rule(EffectDeny, `posture.os-version < "13"`),
+		rule(EffectAllow, `"admins" in device.groups`),
+	}
+
+	tests := []struct {
+		name    string
+		attrs   Attributes
+		def     bool
+		allowed bool
+		rule    int
+		err     bool
+	}{
+		{"old os denied", Attributes{"posture": map[string]string{"os-version": "12.1"}}, true, false, 0, false},
+		{"missing fact denied", Attributes{"posture": map[string]string{}}, true, false, 0, true},
+		{"missing fact denied by default", Attributes{"posture": map[string]string{}}, false, false, 0, true},
+		{"admin allowed", Attributes{
+			"posture": map[string]string{"os-version": "14"},
+			"device":  Attributes{"groups": []string{"admins"}},
+		}, false, true, 1, false},
+		{"default applies", Attributes{
+			"posture": map[string]string{"os-version": "14"},
+			"device":  Attributes{"groups": []string{}},
+		}, true, true, -1, false},
+	}
+
+	for _, tt := range tests {
+		d, matches := Decide(rules, tt.attrs, tt.def)
+		if d.Allowed != tt.allowed || d.Rule != tt.rule || (d.Err != nil) != tt.err {
+			t.Errorf("%s: got %+v", tt.name, d)
+		}
+
+		evaluated := tt.rule + 1
+		if tt.rule < 0 {
+			evaluated = len(rules)
+		}
+		if len(matches) != evaluated {
+			t.Errorf("%s: %d rules evaluated, want %d", tt.name, len(matches), evaluated)
+		}
+	}
+}
+
+// Deny rules hold for devices leaving out the facts they test
+func TestDecideOmittedFacts(t *testing.T) {
+	facts := map[string]string{"disk-encryption": "true", "jailbroken": "false"}
+	for _, tt := range []struct {
+		effect string
+		src    string
+	}{
+		{EffectDeny, `posture.disk-encryption == false`},
+		{EffectDeny, `posture.disk-encryption != true`},
+		{EffectDeny, `posture.jailbroken`},
+		{EffectDeny, `!posture.disk-encryption`},
+		{EffectAllow, `!posture.jailbroken`},
+		{EffectAllow, `posture.disk-encryption == true || posture.jailbroken == false`},
+	} {
+		r, err := ParseRule(tt.effect, tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Submitting the facts allows
+		if d, _ := Decide([]Rule{r}, Attributes{"posture": facts}, true); !d.Allowed || d.Err != nil {
+			t.Errorf("%s with facts: got %+v", r, d)
+		}
+
+		// Omitting them denies
+		d, _ := Decide([]Rule{r}, Attributes{"posture": map[string]string{}}, true)
+		if d.Allowed || d.Err == nil {
+			t.Errorf("%s without facts: got %+v", r, d)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule(EffectDeny, `time.hour < 7`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := r.String(); s != "deny: time.hour < 7" {
+		t.Errorf("String() = %q", s)
+	}
+
+	if _, err := ParseRule("permit", `true`); err == nil {
+		t.Error("ParseRule with unknown effect succeeded")
+	}
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	// Operators and punctuation, the token's text tells which
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// Offset in the expression, used in errors
+	pos int
+}
+
+// Operators and punctuation, longer ones first
+var opTokens = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+// Splits the expression into tokens. Identifiers may contain hyphens after
+// their first character (eg. disk-encryption), since the language has no
+// arithmetic.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s at %d", err, i)
+			}
+			tokens = append(tokens, token{tokenString, s, i})
+			i += n
+
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:j], i})
+			i = j
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(src) && isIdentRune(rune(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, src[i:j], i})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range opTokens {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+func isIdentRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-'
+}
+
+// Reads the quoted string at the start of src. Returns the unquoted string
+// and the number of bytes read. Backslash escapes the next character.
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if i+1 == len(src) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			i++
+			b.WriteByte(src[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
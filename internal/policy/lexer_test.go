@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		src    string
+		tokens []token
+	}{
+		{`posture.disk-encryption == true`, []token{
+			{tokenIdent, "posture", 0},
+			{tokenOp, ".", 7},
+			{tokenIdent, "disk-encryption", 8},
+			{tokenOp, "==", 24},
+			{tokenIdent, "true", 27},
+			{tokenEOF, "", 31},
+		}},
+		{`a<=1.5&&!b`, []token{
+			{tokenIdent, "a", 0},
+			{tokenOp, "<=", 1},
+			{tokenNumber, "1.5", 3},
+			{tokenOp, "&&", 6},
+			{tokenOp, "!", 8},
+			{tokenIdent, "b", 9},
+			{tokenEOF, "", 10},
+		}},
+		{`'it\'s' "x"`, []token{
+			{tokenString, "it's", 0},
+			{tokenString, "x", 8},
+			{tokenEOF, "", 11},
+		}},
+		{``, []token{{tokenEOF, "", 0}}},
+	}
+
+	for _, tt := range tests {
+		tokens, err := lex(tt.src)
+		if err != nil {
+			t.Errorf("lex(%q) failed: %s", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(tokens, tt.tokens) {
+			t.Errorf("lex(%q) = %v, want %v", tt.src, tokens, tt.tokens)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	for _, src := range []string{`"unterminated`, `'escaped\'`, `a = b`, `a & b`, `a | b`, `$`} {
+		if _, err := lex(src); err == nil {
+			t.Errorf("lex(%q) succeeded, want error", src)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Node of the expression's syntax tree
+type node interface {
+	eval(attrs Attributes) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+// Attribute path, eg. posture.disk-encryption or posture["disk-encryption"]
+type path struct {
+	names []string
+}
+
+type list struct {
+	items []node
+}
+
+type not struct {
+	operand node
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+// Recursive descent parser of the grammar:
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = primary [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" ) primary ]
+//	primary = string | number | "true" | "false" | "null" | path | call
+//	        | "[" [ expr { "," expr } ] "]" | "(" expr ")"
+//	path    = ident { "." ident | "[" string "]" }
+//	call    = ident "(" [ expr { "," expr } ] ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Consumes the operator if it is next
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		if t.kind == tokenEOF {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q at %d, got %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand}, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (node, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokenOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" ||
+		t.text == ">" || t.text == ">="):
+	case t.kind == tokenIdent && t.text == "in":
+	default:
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{t.text, left, right}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return &literal{t.text}, nil
+
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %s at %d, quote versions", t.text, t.pos)
+		}
+		return &literal{f}, nil
+
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literal{true}, nil
+		case "false":
+			return &literal{false}, nil
+		case "null":
+			return &literal{nil}, nil
+		}
+
+		if p.accept("(") {
+			args, err := p.items(")")
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := functions[t.text]; !ok {
+				return nil, fmt.Errorf("unknown function %s at %d", t.text, t.pos)
+			}
+			return &call{t.text, args}, nil
+		}
+		return p.path(t.text)
+
+	case tokenOp:
+		switch t.text {
+		case "(":
+			n, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.items("]")
+			if err != nil {
+				return nil, err
+			}
+			return &list{items}, nil
+		}
+	}
+
+	if t.kind == tokenEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// Parses comma separated expressions up to the closing token
+func (p *parser) items(closing string) ([]node, error) {
+	var items []node
+	if p.accept(closing) {
+		return items, nil
+	}
+
+	for {
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, n)
+
+		if p.accept(closing) {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) path(first string) (node, error) {
+	n := &path{[]string{first}}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected attribute name at %d", t.pos)
+			}
+			n.names = append(n.names, t.text)
+
+		case p.accept("["):
+			t := p.next()
+			if t.kind != tokenString {
+				return nil, fmt.Errorf("expected quoted attribute name at %d", t.pos)
+			}
+			n.names = append(n.names, t.text)
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+		default:
+			return n, nil
+		}
+	}
+}
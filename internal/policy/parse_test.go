@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want node
+	}{
+		{`a.b`, &path{[]string{"a", "b"}}},
+		{`a["disk-encryption"].c`, &path{[]string{"a", "disk-encryption", "c"}}},
+		{`null`, &literal{nil}},
+		{`[1, "x", true]`, &list{[]node{&literal{1.0}, &literal{"x"}, &literal{true}}}},
+		{`[]`, &list{}},
+		{`startsWith(a, "x")`, &call{"startsWith", []node{&path{[]string{"a"}}, &literal{"x"}}}},
+		// && binds tighter than ||
+		{`a || b && c`, &binary{"||",
+			&path{[]string{"a"}},
+			&binary{"&&", &path{[]string{"b"}}, &path{[]string{"c"}}}}},
+		{`(a || b) && c`, &binary{"&&",
+			&binary{"||", &path{[]string{"a"}}, &path{[]string{"b"}}},
+			&path{[]string{"c"}}}},
+		// ! applies to the comparison
+		{`!a == b`, &not{&binary{"==", &path{[]string{"a"}}, &path{[]string{"b"}}}}},
+		{`a in ["x"]`, &binary{"in", &path{[]string{"a"}}, &list{[]node{&literal{"x"}}}}},
+		{`a >= "1.2"`, &binary{">=", &path{[]string{"a"}}, &literal{"1.2"}}},
+	}
+
+	for _, tt := range tests {
+		n, err := parse(tt.src)
+		if err != nil {
+			t.Errorf("parse(%q) failed: %s", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(n, tt.want) {
+			t.Errorf("parse(%q) = %#v, want %#v", tt.src, n, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`a ==`,
+		`(a`,
+		`[a, b`,
+		`a b`,
+		`a == b == c`,
+		`a.`,
+		`a[b]`,
+		`unknown(a)`,
+		// Unquoted versions are not numbers
+		`a >= 1.2.3`,
+	} {
+		if _, err := parse(src); err == nil {
+			t.Errorf("parse(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile(`"admins" in device.groups && peer.ip in "10.0.0.0/8"`); err != nil {
+		t.Errorf("Compile failed: %s", err)
+	}
+
+	for _, src := range []string{` `, `foo.bar == 1`, `device.id == [user.id]`, `!startsWith(x, "a")`} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q) succeeded, want error", src)
+		}
+	}
+}
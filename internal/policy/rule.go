@@ -0,0 +1,160 @@
+// Package policy implements a small expression language for access rules,
+// evaluated against the attributes of a discover request (the device, its
+// certificate, the peer address, the time, the posture facts and the service).
+//
+// Expressions compare attributes using ==, !=, <, <=, >, >= and in, combine
+// them using &&, || and ! and may call startsWith and endsWith, eg.
+//
+//	"admins" in device.groups && peer.ip in ["10.0.0.0/8", "192.168.0.0/16"]
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Root attributes expressions may refer to
+var roots = map[string]bool{
+	"device":  true,
+	"cert":    true,
+	"peer":    true,
+	"time":    true,
+	"posture": true,
+	"service": true,
+}
+
+// Rule effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// A compiled expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parses the expression and checks that it only refers to known attributes
+func Compile(src string) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRoots(root); err != nil {
+		return nil, err
+	}
+
+	return &Expr{src, root}, nil
+}
+
+func checkRoots(n node) error {
+	switch n := n.(type) {
+	case *path:
+		if !roots[n.names[0]] {
+			return fmt.Errorf("unknown attribute %s", strings.Join(n.names, "."))
+		}
+	case *list:
+		for _, item := range n.items {
+			if err := checkRoots(item); err != nil {
+				return err
+			}
+		}
+	case *not:
+		return checkRoots(n.operand)
+	case *binary:
+		if err := checkRoots(n.left); err != nil {
+			return err
+		}
+		return checkRoots(n.right)
+	case *call:
+		for _, a := range n.args {
+			if err := checkRoots(a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Returns true if the expression holds for the attributes
+func (e *Expr) Eval(attrs Attributes) (bool, error) {
+	v, err := e.root.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	if err := requireValue(e.root, v, "rule"); err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// Allows or denies the service when the expression holds
+type Rule struct {
+	Effect string
+	When   *Expr
+}
+
+// Parses a rule given its effect (allow or deny) and expression
+func ParseRule(effect, src string) (Rule, error) {
+	if effect != EffectAllow && effect != EffectDeny {
+		return Rule{}, fmt.Errorf("unknown rule effect %s, expected allow or deny", effect)
+	}
+
+	e, err := Compile(src)
+	if err != nil {
+		return Rule{}, fmt.Errorf("%s rule %q: %s", effect, src, err)
+	}
+
+	return Rule{effect, e}, nil
+}
+
+// Returns the rule as in the config, eg. allow: peer.ip in "10.0.0.0/8"
+func (r Rule) String() string {
+	return r.Effect + ": " + r.When.String()
+}
+
+// Outcome of evaluating rules
+type Decision struct {
+	Allowed bool
+	// Index of the matching rule, -1 if none matched and the default applied
+	Rule int
+	// Evaluation error of the rule, which denies
+	Err error
+}
+
+// Outcome of evaluating a single rule
+type Match struct {
+	Rule    Rule
+	Matched bool
+	Err     error
+}
+
+// Evaluates the rules in order, the first matching rule decides. If none
+// matches, the default decides. Rules failing to evaluate deny, so that
+// errors never grant access. Also returns the evaluated rules up to and
+// including the deciding one, explaining the decision.
+func Decide(rules []Rule, attrs Attributes, def bool) (Decision, []Match) {
+	var matches []Match
+	for i, r := range rules {
+		ok, err := r.When.Eval(attrs)
+		matches = append(matches, Match{r, ok, err})
+		if err != nil {
+			return Decision{false, i, err}, matches
+		}
+		if ok {
+			return Decision{r.Effect == EffectAllow, i, nil}, matches
+		}
+	}
+	return Decision{def, -1, nil}, matches
+}
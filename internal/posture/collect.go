@@ -0,0 +1,169 @@
+package posture
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Maximum time a single collector may take
+const collectTimeout = 5 * time.Second
+
+// Collects posture facts of the device
+type Collector interface {
+	// Name used in logs
+	Name() string
+	// Returns the collected facts, which may be several
+	Collect(ctx context.Context) (Facts, error)
+}
+
+// Runs the collectors and returns the facts of all that succeeded. Failing
+// collectors are logged, their facts are missing and thus fail requirements.
+func Collect(ctx context.Context, collectors []Collector) Facts {
+	facts := Facts{}
+	for _, c := range collectors {
+		cctx, cancel := context.WithTimeout(ctx, collectTimeout)
+		f, err := c.Collect(cctx)
+		cancel()
+
+		if err != nil {
+			log.WithField("collector", c.Name()).Warning("Failed to collect posture")
+			log.Warning(err)
+			continue
+		}
+
+		for k, v := range f {
+			facts[k] = v
+		}
+	}
+
+	log.WithField("facts", facts).Debug("Collected posture")
+	return facts
+}
+
+// Returns the built-in collector of the name: os (os and os-version), agent
+// (agent-version), disk-encryption, firewall or screen-lock.
+func Builtin(name, agentVersion string) (Collector, error) {
+	switch name {
+	case "os":
+		return osCollector{}, nil
+	case "agent":
+		return agentCollector{agentVersion}, nil
+	case FactDiskEncryption, FactFirewall, FactScreenLock:
+	default:
+		return nil, fmt.Errorf("unknown posture collector %s", name)
+	}
+
+	cmd, ok := builtinCommands[runtime.GOOS][name]
+	if !ok {
+		return nil, fmt.Errorf("posture collector %s not supported on %s", name, runtime.GOOS)
+	}
+
+	return CommandCollector{name, cmd}, nil
+}
+
+// Shell commands of the built-in boolean facts per OS, the fact is true if
+// the command exits successfully
+var builtinCommands = map[string]map[string]string{
+	"linux": {
+		FactDiskEncryption: "lsblk -rno TYPE | grep -qx crypt",
+		FactFirewall:       "systemctl is-active -q firewalld ufw nftables",
+		FactScreenLock:     "gsettings get org.gnome.desktop.screensaver lock-enabled | grep -qx true",
+	},
+	"darwin": {
+		FactDiskEncryption: "fdesetup status | grep -q 'FileVault is On'",
+		FactFirewall:       "/usr/libexec/ApplicationFirewall/socketfilterfw --getglobalstate | grep -q enabled",
+		FactScreenLock:     "sysadminctl -screenLock status 2>&1 | grep -qv off",
+	},
+}
+
+// Collects a boolean fact using a shell command, the fact is true if the
+// command exits with status 0 and false otherwise.
+type CommandCollector struct {
+	Fact    string
+	Command string
+}
+
+func (c CommandCollector) Name() string {
+	return c.Fact
+}
+
+func (c CommandCollector) Collect(ctx context.Context) (Facts, error) {
+	err := exec.CommandContext(ctx, "sh", "-c", c.Command).Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("posture command of %s timed out", c.Fact)
+	}
+
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, err
+	}
+
+	return Facts{c.Fact: fmt.Sprint(err == nil)}, nil
+}
+
+// Collects the os and os-version facts
+type osCollector struct{}
+
+func (osCollector) Name() string {
+	return "os"
+}
+
+func (osCollector) Collect(ctx context.Context) (Facts, error) {
+	f := Facts{FactOS: runtime.GOOS}
+
+	var version string
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		version, err = osReleaseVersion("/etc/os-release")
+	case "darwin":
+		var out []byte
+		out, err = exec.CommandContext(ctx, "sw_vers", "-productVersion").Output()
+		version = strings.TrimSpace(string(out))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if version != "" {
+		f[FactOSVersion] = version
+	}
+	return f, nil
+}
+
+// Returns the VERSION_ID of the os-release file
+func osReleaseVersion(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if v := strings.TrimPrefix(scanner.Text(), "VERSION_ID="); v != scanner.Text() {
+			return strings.Trim(v, `"'`), nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// Collects the agent-version fact, the version of the client
+type agentCollector struct {
+	version string
+}
+
+func (agentCollector) Name() string {
+	return "agent"
+}
+
+func (c agentCollector) Collect(ctx context.Context) (Facts, error) {
+	return Facts{FactAgentVersion: c.version}, nil
+}
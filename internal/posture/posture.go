@@ -0,0 +1,230 @@
+// Package posture collects device posture facts on the client and checks
+// them against the posture requirements of services on the server.
+package posture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Request header carrying the facts of the device, base64url encoded JSON
+const Header = "OpenSDP-Posture"
+
+// Facts collected by the built-in collectors
+const (
+	FactOS             = "os"
+	FactOSVersion      = "os-version"
+	FactAgentVersion   = "agent-version"
+	FactDiskEncryption = "disk-encryption"
+	FactFirewall       = "firewall"
+	FactScreenLock     = "screen-lock"
+)
+
+// Posture facts of a device by name, eg. disk-encryption: true. Boolean facts
+// are true or false.
+type Facts map[string]string
+
+// Encodes the facts as the value of the posture header
+func (f Facts) Encode() string {
+	data, _ := json.Marshal(f)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decodes the value of the posture header. An empty value means no facts.
+func Decode(value string) (Facts, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, errors.New("posture header is not base64url encoded")
+	}
+
+	f := Facts{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, errors.New("posture header is not a json object of strings")
+	}
+
+	return f, nil
+}
+
+// Comparison operators of requirements
+const (
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpGreaterEqual = ">="
+	OpGreater      = ">"
+	OpLessEqual    = "<="
+	OpLess         = "<"
+)
+
+// Operators in the order they are matched, longer ones first
+var operators = []string{OpEqual, OpNotEqual, OpGreaterEqual, OpLessEqual, OpGreater, OpLess}
+
+// A condition a fact of the device has to meet. Ordering operators compare
+// dotted versions (eg. 13.4.1), equality compares the values as is.
+type Requirement struct {
+	Fact  string
+	Op    string
+	Value string
+}
+
+// Parses the condition of the fact, an operator followed by the value (eg.
+// ">= 13.4"). Without an operator the fact has to equal the value.
+func ParseRequirement(fact, cond string) (Requirement, error) {
+	if fact == "" {
+		return Requirement{}, errors.New("posture requirement without fact")
+	}
+
+	r := Requirement{Fact: fact, Op: OpEqual, Value: strings.TrimSpace(cond)}
+	for _, op := range operators {
+		if strings.HasPrefix(r.Value, op) {
+			r.Op = op
+			r.Value = strings.TrimSpace(strings.TrimPrefix(r.Value, op))
+			break
+		}
+	}
+
+	if r.Value == "" {
+		return Requirement{}, fmt.Errorf("posture requirement %s without value", fact)
+	}
+
+	if r.Op != OpEqual && r.Op != OpNotEqual {
+		if _, err := parseVersion(r.Value); err != nil {
+			return Requirement{}, fmt.Errorf("posture requirement %s: %s", fact, err)
+		}
+	}
+
+	return r, nil
+}
+
+// Parses the requirements, sorted by fact so that equal requirements compare
+// equal
+func ParseRequirements(conds map[string]string) ([]Requirement, error) {
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	reqs := make([]Requirement, 0, len(conds))
+	for fact, cond := range conds {
+		r, err := ParseRequirement(fact, cond)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, r)
+	}
+
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Fact < reqs[j].Fact })
+	return reqs, nil
+}
+
+// Returns the requirement's condition, eg. >= 13.4
+func (r Requirement) String() string {
+	return r.Op + " " + r.Value
+}
+
+// Returns true if the facts meet the requirement. Missing facts never do.
+func (r Requirement) Met(f Facts) bool {
+	v, ok := f[r.Fact]
+	if !ok {
+		return false
+	}
+
+	switch r.Op {
+	case OpEqual:
+		return v == r.Value
+	case OpNotEqual:
+		return v != r.Value
+	}
+
+	have, err := parseVersion(v)
+	if err != nil {
+		return false
+	}
+	want, _ := parseVersion(r.Value)
+	c := compareVersions(have, want)
+
+	switch r.Op {
+	case OpGreaterEqual:
+		return c >= 0
+	case OpGreater:
+		return c > 0
+	case OpLessEqual:
+		return c <= 0
+	case OpLess:
+		return c < 0
+	default:
+		return false
+	}
+}
+
+// Returns the requirements the facts don't meet
+func Unmet(reqs []Requirement, f Facts) []Requirement {
+	var unmet []Requirement
+	for _, r := range reqs {
+		if !r.Met(f) {
+			unmet = append(unmet, r)
+		}
+	}
+	return unmet
+}
+
+// Compares dotted versions (eg. 13.4.1), returns -1, 0 or 1. Fails if either
+// is not a version.
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return compareVersions(va, vb), nil
+}
+
+// Parses a dotted version, a leading v and suffixes such as -beta are ignored
+func parseVersion(s string) ([]int, error) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+ "); i >= 0 {
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	v := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad version %s", s)
+		}
+		v = append(v, n)
+	}
+
+	return v, nil
+}
+
+// Compares dotted versions, missing parts are zero (13.4 equals 13.4.0)
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
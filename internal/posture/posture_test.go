@@ -0,0 +1,189 @@
+package posture
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"13.4", "13.4", 0},
+		// Missing parts are zero
+		{"13.4", "13.4.0", 0},
+		{"13.4.1", "13.4", 1},
+		{"13", "13.0.1", -1},
+		// Parts compare numerically, not lexically
+		{"22.10", "22.9", 1},
+		{"10", "9", 1},
+		// A leading v and suffixes are ignored
+		{"v1.2.3", "1.2.3", 0},
+		{"14.0-beta", "14.0", 0},
+		{"14.1-beta", "14.0.5", 1},
+		{"5.15.0+build1", "5.15", 0},
+		{"22.04 LTS", "22.04", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := CompareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("CompareVersions(%q, %q) failed: %s", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "v", "13.", ".4", "13..4", "13.x", "-1", "beta", "1.-2"} {
+		if _, err := CompareVersions(s, "1"); err == nil {
+			t.Errorf("CompareVersions(%q, \"1\") succeeded, want error", s)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	f := Facts{FactOSVersion: "13.4", FactFirewall: "true"}
+
+	got, err := Decode(f.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[FactOSVersion] != "13.4" || got[FactFirewall] != "true" {
+		t.Errorf("Decode(Encode()) = %v", got)
+	}
+
+	// Padding is accepted
+	if got, err := Decode(f.Encode() + "=="); err != nil || len(got) != 2 {
+		t.Errorf("Decode with padding = %v, %v", got, err)
+	}
+
+	if got, err := Decode(""); err != nil || got != nil {
+		t.Errorf("Decode(\"\") = %v, %v", got, err)
+	}
+
+	for _, value := range []string{
+		"not base64!",
+		// Standard instead of url encoding
+		"eyJhIjoiPz8_In0+/",
+		// Valid base64url, but not a json object of strings
+		Facts{}.Encode()[:1],
+		"WyJhIl0",        // ["a"]
+		"eyJhIjoxfQ",     // {"a":1}
+		"eyJhIjp0cnVlfQ", // {"a":true}
+		"eyJh",           // {"a
+	} {
+		if _, err := Decode(value); err == nil {
+			t.Errorf("Decode(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestParseRequirement(t *testing.T) {
+	tests := []struct {
+		cond string
+		op   string
+		val  string
+	}{
+		{"true", OpEqual, "true"},
+		{"== true", OpEqual, "true"},
+		{"!=false", OpNotEqual, "false"},
+		// Two character operators are matched before their prefixes
+		{">= 13.4", OpGreaterEqual, "13.4"},
+		{"> 13.4", OpGreater, "13.4"},
+		{"<=13", OpLessEqual, "13"},
+		{"< v2.0-rc1", OpLess, "v2.0-rc1"},
+		{"  >=  1.2  ", OpGreaterEqual, "1.2"},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRequirement(FactOSVersion, tt.cond)
+		if err != nil {
+			t.Errorf("ParseRequirement(%q) failed: %s", tt.cond, err)
+			continue
+		}
+		if r.Op != tt.op || r.Value != tt.val || r.Fact != FactOSVersion {
+			t.Errorf("ParseRequirement(%q) = %+v, want %s %s", tt.cond, r, tt.op, tt.val)
+		}
+	}
+
+	for _, tt := range []struct{ fact, cond string }{
+		{"", "true"},
+		{FactOSVersion, ""},
+		{FactOSVersion, ">="},
+		// Ordering operators require versions
+		{FactOSVersion, ">= ventura"},
+		{FactOSVersion, "< 13.x"},
+	} {
+		if _, err := ParseRequirement(tt.fact, tt.cond); err == nil {
+			t.Errorf("ParseRequirement(%q, %q) succeeded, want error", tt.fact, tt.cond)
+		}
+	}
+}
+
+func TestRequirementMet(t *testing.T) {
+	facts := Facts{
+		FactOSVersion:      "13.4.0",
+		FactAgentVersion:   "unknown",
+		FactDiskEncryption: "true",
+	}
+
+	tests := []struct {
+		fact string
+		cond string
+		want bool
+	}{
+		{FactOSVersion, ">= 13.4", true},
+		{FactOSVersion, "> 13.4", false},
+		{FactOSVersion, "<= 13.4", true},
+		{FactOSVersion, "< 13.10", true},
+		{FactDiskEncryption, "true", true},
+		{FactDiskEncryption, "!= true", false},
+		// Equality compares as is
+		{FactOSVersion, "13.4", false},
+		// Missing facts never meet a requirement, not even !=
+		{FactFirewall, "true", false},
+		{FactFirewall, "!= false", false},
+		{FactFirewall, "< 100", false},
+		// Facts that are not versions never meet ordering requirements
+		{FactAgentVersion, ">= 1", false},
+		{FactAgentVersion, "< 1", false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRequirement(tt.fact, tt.cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Met(facts); got != tt.want {
+			t.Errorf("%s %s met = %t, want %t", tt.fact, r, got, tt.want)
+		}
+	}
+}
+
+func TestParseRequirements(t *testing.T) {
+	reqs, err := ParseRequirements(map[string]string{
+		FactOSVersion:      ">= 13",
+		FactDiskEncryption: "true",
+		FactFirewall:       "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sorted by fact
+	want := []string{FactDiskEncryption, FactFirewall, FactOSVersion}
+	for i, r := range reqs {
+		if r.Fact != want[i] {
+			t.Errorf("requirement %d is %s, want %s", i, r.Fact, want[i])
+		}
+	}
+
+	unmet := Unmet(reqs, Facts{FactOSVersion: "12.6", FactFirewall: "true"})
+	if len(unmet) != 2 || unmet[0].Fact != FactDiskEncryption || unmet[1].Fact != FactOSVersion {
+		t.Errorf("Unmet = %+v", unmet)
+	}
+
+	if _, err := ParseRequirements(map[string]string{FactOSVersion: ">= x"}); err == nil {
+		t.Error("ParseRequirements with a bad requirement succeeded")
+	}
+}
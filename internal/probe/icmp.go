@@ -0,0 +1,116 @@
+package probe
+
+import (
+	"errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+// Sends an ICMP echo request and waits for the reply. Unprivileged (datagram)
+// ICMP sockets are tried first, falling back to raw sockets. When neither is
+// permitted the result is inconclusive.
+func probeICMP(ip net.IP, timeout time.Duration) (Result, error) {
+	v4 := ip.To4() != nil
+
+	conn, privileged, err := listenICMP(v4)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EPROTONOSUPPORT) {
+			return Inconclusive, err
+		}
+		return Unreachable, err
+	}
+	defer conn.Close()
+
+	var msgType icmp.Type = ipv4.ICMPTypeEcho
+	var replyType icmp.Type = ipv4.ICMPTypeEchoReply
+	proto := protocolICMP
+	if !v4 {
+		msgType = ipv6.ICMPTypeEchoRequest
+		replyType = ipv6.ICMPTypeEchoReply
+		proto = protocolIPv6ICMP
+	}
+
+	id := os.Getpid() & 0xffff
+	msg := icmp.Message{
+		Type: msgType,
+		Body: &icmp.Echo{ID: id, Seq: 1, Data: []byte("OpenSDP")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return Unreachable, err
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return Unreachable, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Timeout, no echo reply
+			return Unreachable, err
+		}
+
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+
+		// Raw sockets receive every echo reply on the host, so check the sender.
+		// The ID is rewritten by the kernel for datagram sockets.
+		if !peerIP(peer).Equal(ip) {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && privileged && echo.ID != id {
+			continue
+		}
+
+		return Reachable, nil
+	}
+}
+
+func listenICMP(v4 bool) (*icmp.PacketConn, bool, error) {
+	network, address, rawNetwork := "udp4", "0.0.0.0", "ip4:icmp"
+	if !v4 {
+		network, address, rawNetwork = "udp6", "::", "ip6:ipv6-icmp"
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return conn, false, nil
+	}
+
+	conn, err = icmp.ListenPacket(rawNetwork, address)
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, true, nil
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package probe
+
+import (
+	"errors"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+type Result int
+
+const (
+	// The probe received a positive answer (TCP handshake, UDP reply, ICMP echo reply)
+	Reachable Result = iota
+	// The probe was actively refused or timed out where an answer was expected
+	Unreachable
+	// The probe could not tell (eg. silent UDP service or missing privileges for ICMP)
+	Inconclusive
+)
+
+func (r *Result) String() string {
+	switch *r {
+	case Reachable:
+		return "reachable"
+	case Unreachable:
+		return "unreachable"
+	case Inconclusive:
+		return "inconclusive"
+	default:
+		return ""
+	}
+}
+
+type Prober struct {
+	// Timeout of a single probe attempt
+	Timeout time.Duration
+	// Number of attempts after the first failed one
+	Retries int
+	// Delay between two attempts
+	Interval time.Duration
+}
+
+// Probes the ProtoPort of the ip, retrying on failure. Returns the result of
+// the last attempt along with the error that caused it (if any).
+func (p *Prober) Probe(ip net.IP, pp services.ProtoPort) (Result, error) {
+	var res Result
+	var err error
+
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.Interval)
+		}
+
+		switch pp.Protocol {
+		case services.ProtocolTCP:
+			res, err = probeTCP(ip, pp.Port, p.Timeout)
+		case services.ProtocolUDP:
+			res, err = probeUDP(ip, pp.Port, p.Timeout)
+		case services.ProtocolICMP:
+			res, err = probeICMP(ip, p.Timeout)
+		default:
+			return Inconclusive, errors.New("unsupported protocol")
+		}
+
+		log.WithFields(log.Fields{
+			"ip":      ip.String(),
+			"port":    pp.String(),
+			"attempt": attempt + 1,
+			"result":  res.String(),
+		}).Debug("Probe attempt")
+
+		if res != Unreachable {
+			return res, err
+		}
+	}
+
+	return res, err
+}
+
+// Reachable if the TCP handshake succeeds.
+func probeTCP(ip net.IP, port uint16, timeout time.Duration) (Result, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), timeout)
+	if err != nil {
+		return Unreachable, err
+	}
+	conn.Close()
+	return Reachable, nil
+}
+
+// Sends an empty datagram. Any reply means reachable, an ICMP port unreachable
+// (reported as a refused connection) means unreachable, while silence is
+// inconclusive since most UDP services do not answer unknown payloads.
+func probeUDP(ip net.IP, port uint16, timeout time.Duration) (Result, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), timeout)
+	if err != nil {
+		return Unreachable, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte{}); err != nil {
+		return Unreachable, err
+	}
+
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	if err == nil {
+		return Reachable, nil
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return Unreachable, err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Inconclusive, nil
+	}
+
+	return Unreachable, err
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// Interval at which the certificate files are checked for changes, in
+	// case file system notifications are missed or unavailable
+	certPollInterval = time.Minute
+	// Delay after a change of the certificate directories before reloading,
+	// so that files replaced one after another are loaded together
+	certSettleDelay = 100 * time.Millisecond
+)
+
+// Server certificate and client CA bundle, reloaded when their files change.
+// New handshakes use the current ones, established connections are not
+// affected.
+type certStore struct {
+	caPath   string
+	certPath string
+	keyPath  string
+
+	// Guards the fields below
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	// Contents of the files the current certificates were loaded from
+	loaded [][]byte
+}
+
+func newCertStore(caPath, certPath, keyPath string) (*certStore, error) {
+	cs := &certStore{caPath: caPath, certPath: certPath, keyPath: keyPath}
+	if _, err := cs.reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Loads the files again if any of them changed. Returns true if the
+// certificates were replaced. On errors the current certificates are kept.
+func (cs *certStore) reload() (bool, error) {
+	files := make([][]byte, 0, 3)
+	for _, path := range []string{cs.caPath, cs.certPath, cs.keyPath} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		files = append(files, data)
+	}
+
+	cs.mu.RLock()
+	unchanged := cs.loaded != nil &&
+		bytes.Equal(files[0], cs.loaded[0]) &&
+		bytes.Equal(files[1], cs.loaded[1]) &&
+		bytes.Equal(files[2], cs.loaded[2])
+	cs.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	// The CA file may be a bundle, eg. the old and new CA while migrating
+	clientCAs := x509.NewCertPool()
+	if ok := clientCAs.AppendCertsFromPEM(files[0]); !ok {
+		return false, errors.New("no certificates found in ca certificate file")
+	}
+
+	cert, err := tls.X509KeyPair(files[1], files[2])
+	if err != nil {
+		return false, err
+	}
+
+	cs.mu.Lock()
+	cs.cert = &cert
+	cs.clientCAs = clientCAs
+	cs.loaded = files
+	cs.mu.Unlock()
+
+	return true, nil
+}
+
+// Reloads the certificates whenever their files change, until stop is closed.
+// The directories containing the files are watched, so that files replaced by
+// renaming (eg. by certbot or Kubernetes secret updates) are noticed too.
+func (cs *certStore) watch(stop <-chan struct{}) {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+
+	watcher, err := cs.newWatcher()
+	if err != nil {
+		log.Warning("Failed to watch the certificate files, checking them every " + certPollInterval.String())
+		log.Warning(err)
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+
+	settle := time.NewTimer(certSettleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case ev := <-events:
+			if ev.Op != fsnotify.Chmod {
+				settle.Reset(certSettleDelay)
+			}
+			continue
+		case err := <-errs:
+			log.Warning("Failed watching the certificate files")
+			log.Warning(err)
+			continue
+		case <-settle.C:
+		case <-ticker.C:
+		}
+
+		changed, err := cs.reload()
+		if err != nil {
+			// Files may be replaced one after another, retried on the next change
+			log.WithFields(log.Fields{
+				"caCert": cs.caPath,
+				"cert":   cs.certPath,
+				"key":    cs.keyPath,
+			}).Warning("Failed to reload certificates, keeping the current ones")
+			log.Warning(err)
+			continue
+		}
+
+		if changed {
+			log.Info("Reloaded the server certificate and client CAs")
+		}
+	}
+}
+
+// Returns a watcher of the directories containing the certificate files
+func (cs *certStore) newWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]bool)
+	for _, path := range []string{cs.caPath, cs.certPath, cs.keyPath} {
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	return watcher, nil
+}
+
+func (cs *certStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.cert, nil
+}
+
+// Returns a GetConfigForClient callback returning the base config with the
+// current client CAs.
+func (cs *certStore) configForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cs.mu.RLock()
+		clientCAs := cs.clientCAs
+		cs.mu.RUnlock()
+
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = clientCAs
+		return cfg, nil
+	}
+}
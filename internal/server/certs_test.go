@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed certificate with the common name and its key to
+// name.crt and name.key in dir
+func writeTestCert(t *testing.T, dir, name string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedName(t *testing.T, cs *certStore) string {
+	t.Helper()
+	cert, _ := cs.getCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+// Certificates replaced by renaming are used without waiting for the poll
+func TestCertStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "old")
+	writeTestCert(t, dir, "new")
+	writeTestCert(t, dir, "ca")
+
+	live := filepath.Join(dir, "live")
+	if err := os.Mkdir(live, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"ca.crt", "old.crt", "old.key"} {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, f))
+		ioutil.WriteFile(filepath.Join(live, f), data, 0600)
+	}
+
+	certPath, keyPath := filepath.Join(live, "server.crt"), filepath.Join(live, "server.key")
+	os.Rename(filepath.Join(live, "old.crt"), certPath)
+	os.Rename(filepath.Join(live, "old.key"), keyPath)
+
+	cs, err := newCertStore(filepath.Join(live, "ca.crt"), certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, cs); name != "old" {
+		t.Fatalf("serving %s", name)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go cs.watch(stop)
+
+	// Give the watcher time to start
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.Rename(filepath.Join(dir, "new.crt"), certPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "new.key"), keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedName(t, cs) != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated certificate not loaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
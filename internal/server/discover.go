@@ -1,7 +1,8 @@
 package server
 
 import (
-	"encoding/json"
+	"errors"
+	"github.com/greenstatic/opensdp/internal/posture"
 	"github.com/greenstatic/opensdp/internal/services"
 	"net"
 	"net/http"
@@ -90,35 +91,73 @@ func (drs *DiscoverResponseService) ToService() (services.Service, error) {
 	return s, nil
 }
 
+// Returns the services the device making the request is authorized for and
+// whose posture requirements it meets. In case there are none, an error
+// response is written and false returned.
+func (s *Server) authorizedServices(w http.ResponseWriter, req *http.Request) (string, []services.Service, bool) {
+	deviceId, err := s.authenticate(req.TLS.PeerCertificates[0])
+	if err != nil {
+		writeServicesError(w, err)
+		return "", nil, false
+	}
+
+	facts, ok := requestPosture(w, req)
+	if !ok {
+		return deviceId, nil, false
+	}
+
+	srvs, err := s.deviceServices(newDeviceRequest(deviceId, req, facts))
+	if err == nil {
+		srvs, _, err = requirePosture(srvs, facts)
+	}
+	if err != nil {
+		writeServicesError(w, err)
+		return deviceId, nil, false
+	}
+
+	return deviceId, srvs, true
+}
+
+// Returns the attributes of the authenticated HTTPS request
+func newDeviceRequest(deviceId string, req *http.Request, facts posture.Facts) deviceRequest {
+	return deviceRequest{
+		deviceId:   deviceId,
+		cert:       req.TLS.PeerCertificates[0],
+		remoteAddr: req.RemoteAddr,
+		facts:      facts,
+	}
+}
+
+// Writes the error response of a failed service resolution
+func writeServicesError(w http.ResponseWriter, err error) {
+	switch {
+	case err == errUnknownDevice:
+		writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, err.Error())
+	case errors.Is(err, errNoServices):
+		writeError(w, http.StatusForbidden, ErrorCodeNoServices, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, err.Error())
+	}
+}
+
 // Wrapper handler for the discover endpoint. The wrapper allows us to
 // inject the clients slice into the handler function.
 func (s *Server) discoverResponseWrapper() func(w http.ResponseWriter, req *http.Request) {
 
 	return func(w http.ResponseWriter, req *http.Request) {
-		cn := req.TLS.PeerCertificates[0].Subject.CommonName
-
-		client, ok := s.Clients[cn]
-
+		cn, srvs, ok := s.authorizedServices(w, req)
 		if !ok {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(struct {
-				Successful bool   `json:"success"`
-				Error      string `json:"error"`
-			}{
-				false,
-				"not authorized for any services",
-			})
 			return
 		}
 
-		cServices := make([]DiscoverResponseService, 0, len(client.Services))
-		for _, srv := range client.Services {
+		cServices := make([]DiscoverResponseService, 0, len(srvs))
+		for _, srv := range srvs {
 			drs := DiscoverResponseService{}
-			drs.Create(srv.Service)
+			drs.Create(srv)
 			cServices = append(cServices, drs)
 		}
 
-		json.NewEncoder(w).Encode(DiscoverResponse{true, cn, cServices})
+		writeJSON(w, DiscoverResponse{true, cn, cServices})
 	}
 
 }
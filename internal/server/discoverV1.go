@@ -0,0 +1,185 @@
+package server
+
+import (
+	"errors"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Returned by ToService for services with port ranges, which clients skip
+// instead of failing the whole discover
+var ErrPortRange = errors.New("port ranges are not supported")
+
+// Port range of a service. Protocols without ports (eg. icmp) omit start and end.
+type PortRange struct {
+	Protocol string `json:"protocol"`
+	Start    uint16 `json:"start,omitempty"`
+	End      uint16 `json:"end,omitempty"`
+}
+
+type DiscoverV1Service struct {
+	Name       string      `json:"name"`
+	IP         string      `json:"ip"`
+	Ports      []PortRange `json:"ports"`
+	Tags       []string    `json:"tags"`
+	AccessType []string    `json:"accessType"`
+}
+
+type DiscoverV1Response struct {
+	Success  bool   `json:"success"`
+	DeviceId string `json:"deviceId"`
+	// Version of the service set, also sent as the ETag
+	Version  string              `json:"version"`
+	Services []DiscoverV1Service `json:"services"`
+	// Unmet posture requirements of the services withheld from the device
+	PostureFailures []PostureFailure `json:"postureFailures,omitempty"`
+}
+
+// Changes of the device's service set since an earlier version, returned
+// instead of the DiscoverV1Response when requested using the since parameter.
+type DiscoverV1DeltaResponse struct {
+	Success  bool                `json:"success"`
+	DeviceId string              `json:"deviceId"`
+	Version  string              `json:"version"`
+	Since    string              `json:"since"`
+	Added    []DiscoverV1Service `json:"added"`
+	Changed  []DiscoverV1Service `json:"changed"`
+	Removed  []string            `json:"removed"`
+
+	PostureFailures []PostureFailure `json:"postureFailures,omitempty"`
+}
+
+// Fills a DiscoverV1Service struct from a services.Service struct.
+func (ds *DiscoverV1Service) Create(service services.Service) {
+	ds.Name = service.Name
+	ds.IP = service.IP.String()
+
+	ds.Ports = make([]PortRange, 0, len(service.ProtoPort))
+	for _, pp := range service.ProtoPort {
+		pr := PortRange{Protocol: pp.Protocol.String()}
+		if pp.Protocol != services.ProtocolICMP {
+			pr.Start, pr.End = pp.Port, pp.Port
+		}
+		ds.Ports = append(ds.Ports, pr)
+	}
+
+	ds.Tags = service.Tags
+	ds.AccessType = service.AccessTypeToString()
+}
+
+// Returns a services.Service struct from the data in the DiscoverV1Service.
+func (ds *DiscoverV1Service) ToService() (services.Service, error) {
+	s := services.Service{}
+	s.Name = ds.Name
+
+	s.IP = net.ParseIP(ds.IP)
+	if s.IP == nil {
+		return services.Service{}, errors.New("bad service ip")
+	}
+
+	s.ProtoPort = make([]services.ProtoPort, 0, len(ds.Ports))
+	for _, pr := range ds.Ports {
+		var proto services.Protocol
+		proto, err := proto.FromString(pr.Protocol)
+		if err != nil {
+			return services.Service{}, err
+		}
+
+		if pr.Start != pr.End {
+			return services.Service{}, ErrPortRange
+		}
+
+		s.ProtoPort = append(s.ProtoPort, services.ProtoPort{Protocol: proto, Port: pr.Start})
+	}
+
+	s.Tags = ds.Tags
+
+	s.AccessType = make([]services.AccessType, 0, len(ds.AccessType))
+	for _, at := range ds.AccessType {
+		var a services.AccessType
+		if err := a.FromString(at); err != nil {
+			return services.Service{}, err
+		}
+		s.AccessType = append(s.AccessType, a)
+	}
+
+	return s, nil
+}
+
+// Returns the v1 discover response of the device's services whose posture
+// requirements the facts meet
+func newDiscoverV1Response(deviceId string, srvs []services.Service, facts posture.Facts) DiscoverV1Response {
+	srvs, failures := checkPosture(srvs, facts)
+	return discoverV1Response(deviceId, srvs, failures)
+}
+
+// Returns the v1 discover response of the services given to the device and
+// the posture failures of the withheld ones
+func discoverV1Response(deviceId string, srvs []services.Service, failures []PostureFailure) DiscoverV1Response {
+	cServices := make([]DiscoverV1Service, 0, len(srvs))
+	for _, srv := range srvs {
+		ds := DiscoverV1Service{}
+		ds.Create(srv)
+		cServices = append(cServices, ds)
+	}
+
+	return DiscoverV1Response{true, deviceId, serviceSetVersion(cServices, failures), cServices, failures}
+}
+
+// Wrapper handler for the v1 discover endpoint. The response carries the
+// service set's version as its ETag, requests with a matching If-None-Match
+// are answered with 304 Not Modified. Requests with the since parameter set to
+// a known version receive the changes since that version.
+func (s *Server) discoverV1ResponseWrapper() func(w http.ResponseWriter, req *http.Request) {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		deviceId, err := s.authenticate(req.TLS.PeerCertificates[0])
+		if err != nil {
+			writeServicesError(w, err)
+			return
+		}
+
+		facts, ok := requestPosture(w, req)
+		if !ok {
+			return
+		}
+
+		set, err := s.deviceServiceSet(newDeviceRequest(deviceId, req, facts))
+		if err != nil {
+			writeServicesError(w, err)
+			return
+		}
+
+		etag := `"` + set.response.Version + `"`
+		w.Header().Set("ETag", etag)
+
+		if etagMatches(req.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if since := req.URL.Query().Get("since"); since != "" {
+			if delta, ok := s.serviceSetDelta(set, since); ok {
+				writeJSON(w, delta)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(set.body)
+	}
+}
+
+// Returns true if the If-None-Match header value matches the etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Stable error codes of the ErrorResponse
+const (
+	// The device is not known to the server
+	ErrorCodeUnauthorized = "unauthorized"
+	// The device is known but not authorized for any services
+	ErrorCodeNoServices = "no_services"
+	// The requested endpoint does not exist
+	ErrorCodeNotFound = "not_found"
+	// The request is malformed, eg. its posture header
+	ErrorCodeBadRequest = "bad_request"
+	// The server failed to handle the request
+	ErrorCodeInternal = "internal_error"
+)
+
+// Response of all endpoints when a request fails. Shared with the client,
+// which maps the code to its errors.
+type ErrorResponse struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Error   string `json:"error"`
+}
+
+// Writes an ErrorResponse with the status code
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{false, code, msg})
+}
+
+// Writes the value as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/x509"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"net"
+	"time"
+)
+
+// A simulated discover request whose policy decisions are explained. Unset
+// attributes default to the current time and no peer address, client
+// certificate or posture facts.
+type PolicyQuery struct {
+	DeviceId string
+	PeerIP   string
+	Time     time.Time
+	Posture  posture.Facts
+	Cert     *x509.Certificate
+}
+
+// Why each service is given to or withheld from a device
+type PolicyExplanation struct {
+	DeviceId string               `json:"deviceId"`
+	Services []ServiceExplanation `json:"services"`
+}
+
+type ServiceExplanation struct {
+	Service string `json:"service"`
+	Allowed bool   `json:"allowed"`
+	// Listed for the device in the clients file
+	Listed bool `json:"listed"`
+	// Rules evaluated up to and including the deciding one
+	Rules           []RuleExplanation `json:"rules"`
+	Reason          string            `json:"reason"`
+	PostureFailures []PostureFailure  `json:"postureFailures,omitempty"`
+}
+
+type RuleExplanation struct {
+	// The rule as in the services file, eg. allow: "admins" in device.groups
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Explains the policy decision on every service for the simulated request.
+// Services the policy allows are withheld if the certificate is not the
+// device's or the posture facts don't meet their requirements, same as for
+// discover requests.
+func (s *Server) ExplainPolicy(q PolicyQuery) (PolicyExplanation, error) {
+	r := deviceRequest{deviceId: q.DeviceId, cert: q.Cert, facts: q.Posture, time: q.Time}
+	if q.PeerIP != "" {
+		if net.ParseIP(q.PeerIP) == nil {
+			return PolicyExplanation{}, fmt.Errorf("bad peer ip %s", q.PeerIP)
+		}
+		r.remoteAddr = net.JoinHostPort(q.PeerIP, "0")
+	}
+
+	decisions, err := s.decideServices(r)
+	if err != nil {
+		return PolicyExplanation{}, err
+	}
+
+	// Discover requests using the certificate would be rejected as
+	// unauthorized
+	var certErr error
+	if q.Cert != nil {
+		certErr = s.verifyDeviceCertificate(q.DeviceId, q.Cert)
+	}
+
+	exp := PolicyExplanation{DeviceId: q.DeviceId, Services: make([]ServiceExplanation, 0, len(decisions))}
+	for _, sd := range decisions {
+		se := ServiceExplanation{
+			Service: sd.service.Name,
+			Allowed: sd.decision.Allowed,
+			Listed:  sd.listed,
+			Rules:   make([]RuleExplanation, 0, len(sd.matches)),
+			Reason:  decisionReason(sd),
+		}
+
+		for _, m := range sd.matches {
+			re := RuleExplanation{Rule: m.Rule.String(), Matched: m.Matched}
+			if m.Err != nil {
+				re.Error = m.Err.Error()
+			}
+			se.Rules = append(se.Rules, re)
+		}
+
+		if se.Allowed && certErr != nil {
+			se.Allowed = false
+			se.Reason += ", but the certificate is rejected: " + certErr.Error()
+		}
+
+		if se.Allowed {
+			if _, failures := checkPosture([]services.Service{sd.service}, q.Posture); len(failures) > 0 {
+				se.Allowed = false
+				se.Reason += ", but posture requirements are not met"
+				se.PostureFailures = failures
+			}
+		}
+
+		exp.Services = append(exp.Services, se)
+	}
+
+	return exp, nil
+}
+
+// Returns an error if the certificate does not identify the device or the
+// device is bound to another certificate
+func (s *Server) verifyDeviceCertificate(deviceId string, cert *x509.Certificate) error {
+	id, err := s.Identity.DeviceId(cert)
+	if err != nil {
+		return err
+	}
+	if id != deviceId {
+		return fmt.Errorf("certificate identifies device %s", id)
+	}
+
+	_, clnts := s.config()
+	return clnts[deviceId].Cert.Verify(cert)
+}
+
+// Describes how the decision was reached, rules are numbered from 1
+func decisionReason(sd serviceDecision) string {
+	d := sd.decision
+	switch {
+	case d.Err != nil:
+		return fmt.Sprintf("rule %d failed to evaluate", d.Rule+1)
+	case d.Rule >= 0:
+		return fmt.Sprintf("rule %d matched", d.Rule+1)
+	case sd.listed && len(sd.service.Rules) > 0:
+		return "listed for the device, no rule matched"
+	case sd.listed:
+		return "listed for the device"
+	case len(sd.service.Rules) > 0:
+		return "not listed for the device, no rule matched"
+	default:
+		return "not listed for the device"
+	}
+}
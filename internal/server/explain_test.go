@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/policy"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustRule(t *testing.T, effect, src string) policy.Rule {
+	t.Helper()
+	r, err := policy.ParseRule(effect, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestExplainPolicy(t *testing.T) {
+	srvs := []services.Service{
+		{Name: "listed", IP: net.ParseIP("192.0.2.1")},
+		{Name: "office", IP: net.ParseIP("192.0.2.2"), Rules: []policy.Rule{
+			mustRule(t, policy.EffectAllow, `peer.ip in "10.0.0.0/8"`),
+		}},
+		{Name: "night", IP: net.ParseIP("192.0.2.3"), Rules: []policy.Rule{
+			mustRule(t, policy.EffectDeny, `time.hour >= 22`),
+		}},
+		{Name: "broken", IP: net.ParseIP("192.0.2.4"), Rules: []policy.Rule{
+			mustRule(t, policy.EffectDeny, `posture.firewall == false`),
+		}},
+		{Name: "encrypted", IP: net.ParseIP("192.0.2.5"), Posture: []posture.Requirement{
+			{Fact: posture.FactDiskEncryption, Op: posture.OpEqual, Value: "true"},
+		}},
+		{Name: "unlisted", IP: net.ParseIP("192.0.2.6")},
+	}
+
+	listed := []clients.ServicePolicy{{Service: srvs[0]}, {Service: srvs[2]}, {Service: srvs[3]}, {Service: srvs[4]}}
+	s := &Server{
+		Services: srvs,
+		Clients: map[string]clients.Client{
+			grpcDevice: {DeviceId: grpcDevice, Services: listed},
+		},
+	}
+
+	night := time.Date(2026, 1, 5, 23, 0, 0, 0, time.Local)
+	exp, err := s.ExplainPolicy(PolicyQuery{DeviceId: grpcDevice, PeerIP: "192.168.1.2", Time: night})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Listed services first, in their order
+	want := []struct {
+		service string
+		allowed bool
+		listed  bool
+		reason  string
+	}{
+		{"listed", true, true, "listed for the device"},
+		{"night", false, true, "rule 1 matched"},
+		{"broken", false, true, "rule 1 failed to evaluate"},
+		{"encrypted", false, true, "listed for the device, but posture requirements are not met"},
+		{"office", false, false, "not listed for the device, no rule matched"},
+		{"unlisted", false, false, "not listed for the device"},
+	}
+
+	if len(exp.Services) != len(want) {
+		t.Fatalf("got %+v", exp.Services)
+	}
+	for i, w := range want {
+		se := exp.Services[i]
+		if se.Service != w.service || se.Allowed != w.allowed || se.Listed != w.listed || se.Reason != w.reason {
+			t.Errorf("service %d: got %+v, want %+v", i, se, w)
+		}
+	}
+
+	if rules := exp.Services[2].Rules; len(rules) != 1 || rules[0].Error == "" {
+		t.Errorf("broken rules: %+v", rules)
+	}
+	if f := exp.Services[3].PostureFailures; len(f) != 1 || f[0].Fact != posture.FactDiskEncryption {
+		t.Errorf("posture failures: %+v", f)
+	}
+
+	// The simulated request is explained
+	exp, err = s.ExplainPolicy(PolicyQuery{
+		DeviceId: grpcDevice,
+		PeerIP:   "10.1.2.3",
+		Time:     night.Add(-12 * time.Hour),
+		Posture:  posture.Facts{posture.FactDiskEncryption: "true", posture.FactFirewall: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, se := range exp.Services {
+		if se.Allowed != (se.Service != "unlisted") {
+			t.Errorf("%s: got %+v", se.Service, se)
+		}
+	}
+	if r := exp.Services[4].Reason; r != "rule 1 matched" {
+		t.Errorf("office reason %q", r)
+	}
+
+	if _, err := s.ExplainPolicy(PolicyQuery{DeviceId: grpcUnknownDevice}); err != errUnknownDevice {
+		t.Errorf("unknown device: got %v", err)
+	}
+	if _, err := s.ExplainPolicy(PolicyQuery{DeviceId: grpcDevice, PeerIP: "10.1"}); err == nil {
+		t.Error("bad peer ip succeeded")
+	}
+}
+
+// Certificates discover would reject withhold every service
+func TestExplainPolicyCertificate(t *testing.T) {
+	bound := &x509.Certificate{Raw: []byte("bound"), SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: grpcDevice}}
+	other := &x509.Certificate{Raw: []byte("other"), SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{CommonName: grpcDevice}}
+	otherDevice := &x509.Certificate{Raw: []byte("device"), SerialNumber: big.NewInt(3),
+		Subject: pkix.Name{CommonName: grpcNoServicesDevice}}
+
+	srv := services.Service{Name: "listed", IP: net.ParseIP("192.0.2.1")}
+	s := &Server{
+		Services: []services.Service{srv},
+		Clients: map[string]clients.Client{
+			grpcDevice: {
+				DeviceId: grpcDevice,
+				Services: []clients.ServicePolicy{{Service: srv}},
+				Cert:     clients.CertBinding{Fingerprint: clients.Fingerprint(bound)},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		allowed bool
+		reason  string
+	}{
+		{"no certificate", nil, true, "listed for the device"},
+		{"bound certificate", bound, true, "listed for the device"},
+		{"other certificate", other, false, "but the certificate is rejected: certificate fingerprint"},
+		{"other device", otherDevice, false, "but the certificate is rejected: certificate identifies device " +
+			grpcNoServicesDevice},
+	}
+
+	for _, tt := range tests {
+		exp, err := s.ExplainPolicy(PolicyQuery{DeviceId: grpcDevice, Cert: tt.cert})
+		if err != nil {
+			t.Fatal(err)
+		}
+		se := exp.Services[0]
+		if se.Allowed != tt.allowed || !strings.Contains(se.Reason, tt.reason) {
+			t.Errorf("%s: got %+v", tt.name, se)
+		}
+	}
+
+	// As discover does
+	if _, err := s.authenticate(other); err != errUnknownDevice {
+		t.Errorf("authenticate got %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	opensdpv1 "github.com/greenstatic/opensdp/api/opensdp/v1"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sort"
+	"time"
+)
+
+// Implements the gRPC API using the same policy resolution as the HTTPS API
+type grpcServer struct {
+	opensdpv1.UnimplementedOpenSDPServer
+	s *Server
+}
+
+// Starts serving the gRPC API on the listener in the background. Clients are
+// authenticated using the same mutual TLS config as the HTTPS API.
+func (s *Server) startGRPC(certs *certStore, tlsConfig *tls.Config, ln net.Listener) *grpc.Server {
+	grpcTLSConfig := tlsConfig.Clone()
+	grpcTLSConfig.NextProtos = []string{"h2"}
+	grpcTLSConfig.GetConfigForClient = certs.configForClient(grpcTLSConfig)
+
+	gs := grpc.NewServer(grpc.Creds(credentials.NewTLS(grpcTLSConfig)))
+	opensdpv1.RegisterOpenSDPServer(gs, &grpcServer{s: s})
+
+	log.WithField("addr", ln.Addr().String()).Info("Starting gRPC server")
+
+	go func() {
+		if err := gs.Serve(ln); err != nil {
+			log.Error("gRPC server failed")
+			log.Error(err)
+		}
+	}()
+
+	return gs
+}
+
+// Returns the device ID of the peer's certificate
+func (s *Server) grpcDeviceId(ctx context.Context) (string, error) {
+	r, err := s.grpcRequest(ctx, nil)
+	return r.deviceId, err
+}
+
+// Returns the authenticated request of the peer given its posture facts
+func (s *Server) grpcRequest(ctx context.Context, facts posture.Facts) (deviceRequest, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return deviceRequest{}, status.Error(codes.Unauthenticated, "no peer")
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return deviceRequest{}, status.Error(codes.Unauthenticated, "no client certificate")
+	}
+
+	cert := tlsInfo.State.PeerCertificates[0]
+	deviceId, err := s.authenticate(cert)
+	if err != nil {
+		return deviceRequest{}, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return deviceRequest{
+		deviceId:   deviceId,
+		cert:       cert,
+		remoteAddr: p.Addr.String(),
+		facts:      facts,
+	}, nil
+}
+
+// Returns the device's discover response for the request or a gRPC status
+// error. Posture withholding every service fails like the HTTPS API, unless
+// watching, in which case the empty set with the failures is returned.
+func (g *grpcServer) discover(r deviceRequest, watching bool) (*opensdpv1.DiscoverResponse, error) {
+	srvs, err := g.s.deviceServices(r)
+	if err != nil {
+		return nil, grpcServicesError(err)
+	}
+
+	srvs, failures := checkPosture(srvs, r.facts)
+	if len(srvs) == 0 && !watching {
+		return nil, grpcServicesError(&postureError{failures})
+	}
+
+	return &opensdpv1.DiscoverResponse{
+		DeviceId:        r.deviceId,
+		Services:        toProtoServices(srvs),
+		PostureFailures: toProtoPostureFailures(failures),
+	}, nil
+}
+
+// Returns the gRPC status error of a failed service resolution
+func grpcServicesError(err error) error {
+	switch {
+	case err == errUnknownDevice:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, errNoServices):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (g *grpcServer) Discover(ctx context.Context, req *opensdpv1.DiscoverRequest) (*opensdpv1.DiscoverResponse, error) {
+	r, err := g.s.grpcRequest(ctx, req.GetPosture())
+	if err != nil {
+		return nil, err
+	}
+
+	return g.discover(r, false)
+}
+
+func (g *grpcServer) WatchServices(req *opensdpv1.WatchServicesRequest, stream opensdpv1.OpenSDP_WatchServicesServer) error {
+	ctx := stream.Context()
+	if _, err := g.s.grpcDeviceId(ctx); err != nil {
+		return err
+	}
+
+	changed, stop := g.s.watch()
+	defer stop()
+
+	// Policy rules may depend on the time
+	recheck := time.NewTicker(watchKeepAlive)
+	defer recheck.Stop()
+
+	postureExpired, stopExpiry := g.s.postureExpiry()
+	defer stopExpiry()
+
+	var last *opensdpv1.DiscoverResponse
+	for {
+		// The device may have been bound to another certificate since
+		r, err := g.s.grpcRequest(ctx, req.GetPosture())
+		if err != nil {
+			return err
+		}
+
+		resp, err := g.discover(r, true)
+		if status.Code(err) == codes.PermissionDenied {
+			// The device may be granted services later on
+			resp, err = &opensdpv1.DiscoverResponse{DeviceId: r.deviceId}, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if last == nil || !proto.Equal(last, resp) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			last = resp
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-g.s.shuttingDown():
+			return nil
+		case <-postureExpired:
+			return nil
+		case <-changed:
+		case <-recheck.C:
+		}
+	}
+}
+
+// Returns an error unless the peer is an admin
+func (g *grpcServer) requireAdmin(ctx context.Context) error {
+	deviceId, err := g.s.grpcDeviceId(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !g.s.isAdmin(deviceId) {
+		log.WithField("deviceId", deviceId).Warning("Denied admin operation")
+		return status.Error(codes.PermissionDenied, "not an admin")
+	}
+
+	return nil
+}
+
+func (g *grpcServer) ReloadConfig(ctx context.Context, req *opensdpv1.ReloadConfigRequest) (*opensdpv1.ReloadConfigResponse, error) {
+	if err := g.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := g.s.ReloadConfig(); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	srvs, clnts := g.s.config()
+	return &opensdpv1.ReloadConfigResponse{Services: int32(len(srvs)), Clients: int32(len(clnts))}, nil
+}
+
+func (g *grpcServer) ListServices(ctx context.Context, req *opensdpv1.ListServicesRequest) (*opensdpv1.ListServicesResponse, error) {
+	if err := g.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	srvs, _ := g.s.config()
+	return &opensdpv1.ListServicesResponse{Services: toProtoServices(srvs)}, nil
+}
+
+func (g *grpcServer) ListClients(ctx context.Context, req *opensdpv1.ListClientsRequest) (*opensdpv1.ListClientsResponse, error) {
+	if err := g.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	_, clnts := g.s.config()
+
+	ids := make([]string, 0, len(clnts))
+	for id := range clnts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	resp := &opensdpv1.ListClientsResponse{}
+	for _, id := range ids {
+		c := clnts[id]
+		pc := &opensdpv1.Client{DeviceId: c.DeviceId, Label: c.Label}
+		for _, sp := range c.Services {
+			pc.Services = append(pc.Services, sp.Service.Name)
+		}
+		resp.Clients = append(resp.Clients, pc)
+	}
+
+	return resp, nil
+}
+
+func (g *grpcServer) ExplainPolicy(ctx context.Context, req *opensdpv1.ExplainPolicyRequest) (*opensdpv1.ExplainPolicyResponse, error) {
+	if err := g.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	// Same form as the clients file and the IDs extracted from certificates
+	deviceId, err := g.s.Identity.ParseDeviceId(req.GetDeviceId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "bad device id: "+err.Error())
+	}
+
+	q := PolicyQuery{DeviceId: deviceId, PeerIP: req.GetPeerIp(), Posture: req.GetPosture()}
+	if req.Time != nil {
+		q.Time = req.GetTime().AsTime().Local()
+	}
+	if der := req.GetCertificate(); len(der) > 0 {
+		if q.Cert, err = x509.ParseCertificate(der); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "bad certificate: "+err.Error())
+		}
+	}
+
+	exp, err := g.s.ExplainPolicy(q)
+	switch {
+	case err == errUnknownDevice:
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := &opensdpv1.ExplainPolicyResponse{DeviceId: exp.DeviceId}
+	for _, se := range exp.Services {
+		sd := &opensdpv1.ServiceDecision{
+			Service: se.Service,
+			Allowed: se.Allowed,
+			Listed:  se.Listed,
+			Reason:  se.Reason,
+		}
+		for _, re := range se.Rules {
+			sd.Rules = append(sd.Rules, &opensdpv1.RuleEvaluation{Rule: re.Rule, Matched: re.Matched, Error: re.Error})
+		}
+		sd.PostureFailures = toProtoPostureFailures(se.PostureFailures)
+		resp.Services = append(resp.Services, sd)
+	}
+
+	return resp, nil
+}
+
+func toProtoPostureFailures(failures []PostureFailure) []*opensdpv1.PostureFailure {
+	var pf []*opensdpv1.PostureFailure
+	for _, f := range failures {
+		pf = append(pf, &opensdpv1.PostureFailure{
+			Service:     f.Service,
+			Fact:        f.Fact,
+			Requirement: f.Requirement,
+			Actual:      f.Actual,
+		})
+	}
+	return pf
+}
+
+func toProtoServices(srvs []services.Service) []*opensdpv1.Service {
+	ps := make([]*opensdpv1.Service, 0, len(srvs))
+	for _, srv := range srvs {
+		p := &opensdpv1.Service{
+			Name:       srv.Name,
+			Ip:         srv.IP.String(),
+			Tags:       srv.Tags,
+			AccessType: srv.AccessTypeToString(),
+		}
+
+		for _, pp := range srv.ProtoPort {
+			pr := &opensdpv1.PortRange{Protocol: pp.Protocol.String()}
+			if pp.Protocol != services.ProtocolICMP {
+				pr.Start, pr.End = uint32(pp.Port), uint32(pp.Port)
+			}
+			p.Ports = append(p.Ports, pr)
+		}
+
+		ps = append(ps, p)
+	}
+	return ps
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	opensdpv1 "github.com/greenstatic/opensdp/api/opensdp/v1"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	grpcDevice           = "9f84fbb8-10e8-4b8a-abd2-bb91cbf484df"
+	grpcNoServicesDevice = "c1a2b4b4-41d8-4c3e-9a0b-5b5f1d5ad1f0"
+	grpcUnknownDevice    = "00000000-0000-0000-0000-000000000000"
+)
+
+var grpcServices = []services.Service{
+	{
+		Name:       "example-www",
+		IP:         net.ParseIP("192.0.2.1"),
+		ProtoPort:  []services.ProtoPort{{Protocol: services.ProtocolTCP, Port: 80}},
+		AccessType: []services.AccessType{services.AccessTypeOpenSPA},
+	},
+	{
+		Name:       "example-ssh",
+		IP:         net.ParseIP("192.0.2.2"),
+		ProtoPort:  []services.ProtoPort{{Protocol: services.ProtocolTCP, Port: 22}},
+		AccessType: []services.AccessType{services.AccessTypeOpenSPA},
+	},
+}
+
+func newGRPCTestServer() *grpcServer {
+	return &grpcServer{s: &Server{
+		Services: grpcServices,
+		Clients: map[string]clients.Client{
+			grpcDevice: {
+				DeviceId: grpcDevice,
+				Services: []clients.ServicePolicy{{Service: grpcServices[0]}},
+			},
+			grpcNoServicesDevice: {DeviceId: grpcNoServicesDevice},
+		},
+	}}
+}
+
+// Returns the context of a gRPC call authenticated using the certificate
+func peerContext(ctx context.Context, cert *x509.Certificate) context.Context {
+	return peer.NewContext(ctx, &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 50000},
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+		},
+	})
+}
+
+func deviceCert(deviceId string) *x509.Certificate {
+	return &x509.Certificate{Subject: pkix.Name{CommonName: deviceId}}
+}
+
+func TestGRPCDiscover(t *testing.T) {
+	g := newGRPCTestServer()
+
+	resp, err := g.Discover(peerContext(context.Background(), deviceCert(grpcDevice)), &opensdpv1.DiscoverRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetDeviceId() != grpcDevice || len(resp.GetServices()) != 1 || resp.GetServices()[0].GetName() != "example-www" {
+		t.Errorf("got %v", resp)
+	}
+	if p := resp.GetServices()[0].GetPorts(); len(p) != 1 || p[0].GetStart() != 80 || p[0].GetEnd() != 80 {
+		t.Errorf("got ports %v", p)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"no peer", context.Background(), codes.Unauthenticated},
+		{"no certificate", peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{}}),
+			codes.Unauthenticated},
+		{"unknown device", peerContext(context.Background(), deviceCert(grpcUnknownDevice)), codes.Unauthenticated},
+		{"no services", peerContext(context.Background(), deviceCert(grpcNoServicesDevice)), codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		if _, err := g.Discover(tt.ctx, &opensdpv1.DiscoverRequest{}); status.Code(err) != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.code)
+		}
+	}
+}
+
+// Collects the responses sent on a WatchServices stream
+type watchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *opensdpv1.DiscoverResponse
+}
+
+func (w *watchStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *watchStream) Send(resp *opensdpv1.DiscoverResponse) error {
+	w.sent <- resp
+	return nil
+}
+
+func (w *watchStream) next(t *testing.T) *opensdpv1.DiscoverResponse {
+	t.Helper()
+	select {
+	case resp := <-w.sent:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response sent")
+		return nil
+	}
+}
+
+func TestGRPCWatchServices(t *testing.T) {
+	g := newGRPCTestServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchStream{
+		ctx:  peerContext(ctx, deviceCert(grpcDevice)),
+		sent: make(chan *opensdpv1.DiscoverResponse, 10),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- g.WatchServices(&opensdpv1.WatchServicesRequest{}, stream)
+	}()
+
+	if resp := stream.next(t); len(resp.GetServices()) != 1 {
+		t.Errorf("got %v", resp)
+	}
+
+	// Changes are pushed
+	clnts := map[string]clients.Client{
+		grpcDevice: {
+			DeviceId: grpcDevice,
+			Services: []clients.ServicePolicy{{Service: grpcServices[0]}, {Service: grpcServices[1]}},
+		},
+	}
+	g.s.SetConfig(grpcServices, clnts)
+	if resp := stream.next(t); len(resp.GetServices()) != 2 {
+		t.Errorf("got %v", resp)
+	}
+
+	// Losing all services sends an empty set instead of ending the watch
+	g.s.SetConfig(grpcServices, map[string]clients.Client{grpcDevice: {DeviceId: grpcDevice}})
+	if resp := stream.next(t); resp.GetDeviceId() != grpcDevice || len(resp.GetServices()) != 0 {
+		t.Errorf("got %v", resp)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WatchServices failed: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchServices did not end")
+	}
+
+	// Unknown devices cannot watch
+	stream.ctx = peerContext(context.Background(), deviceCert(grpcUnknownDevice))
+	if err := g.WatchServices(&opensdpv1.WatchServicesRequest{}, stream); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unknown device: got %v", err)
+	}
+}
+
+// Admins written in another form than the certificates' device IDs are
+// authorized once normalized, others are denied every admin operation
+func TestGRPCAdmin(t *testing.T) {
+	adminCert := &x509.Certificate{Raw: []byte("admin")}
+	otherCert := &x509.Certificate{Raw: []byte("other")}
+
+	// As printed by openssl x509 -fingerprint -sha256
+	sum := sha256.Sum256(adminCert.Raw)
+	var hexBytes []string
+	for _, b := range sum {
+		hexBytes = append(hexBytes, fmt.Sprintf("%02X", b))
+	}
+
+	identity := Identity{Source: IdentityFingerprint}
+	admin, err := identity.ParseDeviceId(strings.Join(hexBytes, ":"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &grpcServer{s: &Server{
+		Services: grpcServices,
+		Clients: map[string]clients.Client{
+			admin: {DeviceId: admin, Services: []clients.ServicePolicy{{Service: grpcServices[0]}}},
+		},
+		Admins:   []string{admin},
+		Identity: identity,
+	}}
+
+	adminCtx := peerContext(context.Background(), adminCert)
+	otherCtx := peerContext(context.Background(), otherCert)
+
+	resp, err := g.ListClients(adminCtx, &opensdpv1.ListClientsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetClients()) != 1 || resp.GetClients()[0].GetDeviceId() != admin {
+		t.Errorf("ListClients got %v", resp)
+	}
+
+	if _, err := g.ListServices(adminCtx, &opensdpv1.ListServicesRequest{}); err != nil {
+		t.Errorf("ListServices failed: %s", err)
+	}
+
+	exp, err := g.ExplainPolicy(adminCtx, &opensdpv1.ExplainPolicyRequest{DeviceId: strings.Join(hexBytes, ":")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.GetDeviceId() != admin {
+		t.Errorf("ExplainPolicy got %v", exp)
+	}
+
+	denied := map[string]func(ctx context.Context) error{
+		"ReloadConfig": func(ctx context.Context) error {
+			_, err := g.ReloadConfig(ctx, &opensdpv1.ReloadConfigRequest{})
+			return err
+		},
+		"ListServices": func(ctx context.Context) error {
+			_, err := g.ListServices(ctx, &opensdpv1.ListServicesRequest{})
+			return err
+		},
+		"ListClients": func(ctx context.Context) error {
+			_, err := g.ListClients(ctx, &opensdpv1.ListClientsRequest{})
+			return err
+		},
+		"ExplainPolicy": func(ctx context.Context) error {
+			_, err := g.ExplainPolicy(ctx, &opensdpv1.ExplainPolicyRequest{DeviceId: admin})
+			return err
+		},
+	}
+
+	for name, call := range denied {
+		if err := call(otherCtx); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("%s by other device: got %v", name, err)
+		}
+		if err := call(context.Background()); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s without peer: got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+)
+
+// Sources of the device ID in the client certificate
+const (
+	// Subject common name, a UUID (default)
+	IdentityCN = "cn"
+	// URI subject alternative name, eg. a SPIFFE ID
+	IdentityURISAN = "uri-san"
+	// DNS subject alternative name
+	IdentityDNSSAN = "dns-san"
+	// SHA-256 fingerprint of the certificate
+	IdentityFingerprint = "fingerprint"
+)
+
+// How the device ID is extracted from the client certificate
+type Identity struct {
+	// One of the Identity* sources, cn if empty
+	Source string
+	// Only SANs starting with the prefix are used (eg. spiffe://example.org/),
+	// applies to uri-san and dns-san
+	Prefix string
+}
+
+// Returns an error if the source is unknown or the prefix is set for a
+// source without SANs
+func (i Identity) Validate() error {
+	switch i.Source {
+	case IdentityCN, "", IdentityFingerprint:
+		if i.Prefix != "" {
+			return fmt.Errorf("identity prefix is only supported by %s and %s", IdentityURISAN, IdentityDNSSAN)
+		}
+	case IdentityURISAN, IdentityDNSSAN:
+	default:
+		return fmt.Errorf("unknown identity source %s, expected %s, %s, %s or %s",
+			i.Source, IdentityCN, IdentityURISAN, IdentityDNSSAN, IdentityFingerprint)
+	}
+	return nil
+}
+
+// Returns the device ID of the client certificate. Fails if the certificate
+// has no or several matching SANs, since picking one would be arbitrary.
+func (i Identity) DeviceId(cert *x509.Certificate) (string, error) {
+	var ids []string
+	switch i.Source {
+	case IdentityCN, "":
+		if cert.Subject.CommonName == "" {
+			return "", errors.New("certificate without common name")
+		}
+		return cert.Subject.CommonName, nil
+
+	case IdentityFingerprint:
+		return clients.Fingerprint(cert), nil
+
+	case IdentityURISAN:
+		for _, u := range cert.URIs {
+			if strings.HasPrefix(u.String(), i.Prefix) {
+				ids = append(ids, u.String())
+			}
+		}
+
+	case IdentityDNSSAN:
+		for _, name := range cert.DNSNames {
+			if strings.HasPrefix(name, i.Prefix) {
+				ids = append(ids, name)
+			}
+		}
+
+	default:
+		return "", fmt.Errorf("unknown identity source %s", i.Source)
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("certificate without %s matching prefix %q", i.Source, i.Prefix)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("certificate with several %s matching prefix %q", i.Source, i.Prefix)
+	}
+}
+
+// Validates a device ID of the clients file and returns it in the form
+// extracted from certificates
+func (i Identity) ParseDeviceId(id string) (string, error) {
+	switch i.Source {
+	case IdentityCN, "":
+		if _, err := uuid.FromString(id); err != nil {
+			return "", err
+		}
+		return id, nil
+
+	case IdentityFingerprint:
+		return clients.ParseFingerprint(id)
+
+	case IdentityURISAN:
+		u, err := url.Parse(id)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme == "" {
+			return "", fmt.Errorf("device id %s is not an absolute uri", id)
+		}
+
+	case IdentityDNSSAN:
+		if id == "" || strings.ContainsAny(id, " /:") {
+			return "", fmt.Errorf("device id %s is not a dns name", id)
+		}
+
+	default:
+		return "", fmt.Errorf("unknown identity source %s", i.Source)
+	}
+
+	if !strings.HasPrefix(id, i.Prefix) {
+		return "", fmt.Errorf("device id %s does not start with the identity prefix %s", id, i.Prefix)
+	}
+	return id, nil
+}
+
+// Returns the device ID of the client certificate. Devices bound to a
+// certificate are only authenticated using that certificate, otherwise
+// errUnknownDevice is returned.
+func (s *Server) authenticate(cert *x509.Certificate) (string, error) {
+	deviceId, err := s.Identity.DeviceId(cert)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"subject": cert.Subject.String(),
+			"serial":  clients.FormatSerial(cert.SerialNumber),
+		}).Warning("Failed to identify device")
+		log.Warning(err)
+		return "", errUnknownDevice
+	}
+
+	s.mu.RLock()
+	client, ok := s.Clients[deviceId]
+	s.mu.RUnlock()
+
+	if ok {
+		if err := client.Cert.Verify(cert); err != nil {
+			log.WithField("deviceId", deviceId).Warning("Rejected certificate not bound to the device")
+			log.Warning(err)
+			return "", errUnknownDevice
+		}
+	}
+
+	return deviceId, nil
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the server's listeners, matched against systemd's FileDescriptorName
+const (
+	ListenerHTTPS = "https"
+	ListenerGRPC  = "grpc"
+)
+
+// Environment variables of socket activation (sd_listen_fds(3)), of systemd's
+// notification socket (sd_notify(3)) and of the readiness pipe used during a
+// handoff
+const (
+	listenFdsEnv     = "LISTEN_FDS"
+	listenPidEnv     = "LISTEN_PID"
+	listenFdNamesEnv = "LISTEN_FDNAMES"
+	notifySocketEnv  = "NOTIFY_SOCKET"
+	readyFdEnv       = "OPENSDP_READY_FD"
+)
+
+// First file descriptor passed using socket activation
+const listenFdsStart = 3
+
+// Time the new process has to become ready during a handoff
+const handoffTimeout = 30 * time.Second
+
+// Returns the listeners passed by systemd socket activation or by the
+// previous process during a handoff, by name. Unnamed listeners are assigned
+// in the order https, grpc.
+func inheritedListeners() (map[string]net.Listener, error) {
+	lns := make(map[string]net.Listener)
+
+	fds := os.Getenv(listenFdsEnv)
+	if fds == "" {
+		return lns, nil
+	}
+
+	if pid := os.Getenv(listenPidEnv); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		// Meant for another process
+		return lns, nil
+	}
+
+	n, err := strconv.Atoi(fds)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %s", listenFdsEnv, err)
+	}
+
+	names := strings.Split(os.Getenv(listenFdNamesEnv), ":")
+	defaultNames := []string{ListenerHTTPS, ListenerGRPC}
+
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		if name == "" || name == "unknown" {
+			if i >= len(defaultNames) {
+				return nil, fmt.Errorf("unexpected listener %d", i)
+			}
+			name = defaultNames[i]
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited listener %s: %s", name, err)
+		}
+
+		log.WithFields(log.Fields{
+			"listener": name,
+			"addr":     ln.Addr().String(),
+		}).Info("Using inherited listener")
+
+		lns[name] = ln
+	}
+
+	// Not meant for our children
+	os.Unsetenv(listenFdsEnv)
+	os.Unsetenv(listenPidEnv)
+	os.Unsetenv(listenFdNamesEnv)
+
+	return lns, nil
+}
+
+// Returns the inherited listener with the name or listens on the address.
+func listen(inherited map[string]net.Listener, name, addr string) (net.Listener, error) {
+	if ln, ok := inherited[name]; ok {
+		return ln, nil
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// Sends the state to systemd's notification socket, if the server runs as a
+// systemd service with Type=notify.
+func sdNotify(state string) error {
+	addr := os.Getenv(notifySocketEnv)
+	if addr == "" {
+		return nil
+	}
+	if strings.HasPrefix(addr, "@") {
+		// Abstract socket
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Tells systemd, or the previous process that started us during a handoff,
+// that we are serving. The previous process then shuts down and passes the
+// service's main PID on to us.
+func notifyReady() {
+	fdStr := os.Getenv(readyFdEnv)
+	if fdStr == "" {
+		if err := sdNotify("READY=1"); err != nil {
+			log.Error("Failed to notify systemd that the server is ready")
+			log.Error(err)
+		}
+		return
+	}
+	os.Unsetenv(readyFdEnv)
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// Starts a new server process with the same arguments that inherits the
+// listeners and waits until it is serving. The caller should Shutdown the
+// server afterwards, connections are accepted by the new process meanwhile,
+// so none are refused. Under systemd the new process is made the service's
+// main process, so the unit keeps running once we exit.
+func (s *Server) Handoff() error {
+	s.lifecycleMu.Lock()
+	names := make([]string, 0, len(s.listeners))
+	files := make([]*os.File, 0, len(s.listeners))
+	for _, name := range []string{ListenerHTTPS, ListenerGRPC} {
+		ln, ok := s.listeners[name]
+		if !ok {
+			continue
+		}
+
+		tcpLn, ok := ln.(*net.TCPListener)
+		if !ok {
+			s.lifecycleMu.Unlock()
+			return fmt.Errorf("listener %s cannot be passed on", name)
+		}
+
+		f, err := tcpLn.File()
+		if err != nil {
+			s.lifecycleMu.Unlock()
+			return err
+		}
+		defer f.Close()
+
+		names = append(names, name)
+		files = append(files, f)
+	}
+	s.lifecycleMu.Unlock()
+
+	if len(files) == 0 {
+		return errors.New("server is not listening")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	env := make([]string, 0, len(os.Environ())+4)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, listenFdsEnv+"=") && !strings.HasPrefix(e, listenPidEnv+"=") &&
+			!strings.HasPrefix(e, listenFdNamesEnv+"=") && !strings.HasPrefix(e, readyFdEnv+"=") {
+			env = append(env, e)
+		}
+	}
+	env = append(env,
+		listenFdsEnv+"="+strconv.Itoa(len(files)),
+		listenFdNamesEnv+"="+strings.Join(names, ":"),
+		readyFdEnv+"="+strconv.Itoa(listenFdsStart+len(files)),
+	)
+
+	// The listeners become fds 3.. in the new process, followed by the pipe
+	proc, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, append(files, readyW)...),
+	})
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	log.WithField("pid", proc.Pid).Info("Started new server process, waiting until it is ready")
+
+	ready := make(chan bool, 1)
+	go func() {
+		b := make([]byte, 1)
+		n, _ := readyR.Read(b)
+		ready <- n == 1
+	}()
+
+	select {
+	case ok := <-ready:
+		if !ok {
+			proc.Wait()
+			return errors.New("new server process exited before it was ready")
+		}
+	case <-time.After(handoffTimeout):
+		proc.Kill()
+		proc.Wait()
+		return errors.New("new server process did not become ready in time")
+	}
+
+	if err := sdNotify("MAINPID=" + strconv.Itoa(proc.Pid)); err != nil {
+		log.Error("Failed to pass the main PID on to the new server process")
+		log.Error(err)
+	}
+
+	return nil
+}
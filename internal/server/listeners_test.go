@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "notify"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv(notifySocketEnv, addr.Name)
+	defer os.Unsetenv(notifySocketEnv)
+
+	if err := sdNotify("MAINPID=42"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b[:n]); got != "MAINPID=42" {
+		t.Errorf("got %q", got)
+	}
+
+	// Not running under systemd
+	os.Unsetenv(notifySocketEnv)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("without %s: %s", notifySocketEnv, err)
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// Path the OpenAPI document is served at
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPI 3 document describing all the endpoints of the server
+//
+//go:embed openapi.json
+var OpenAPIDocument []byte
+
+func openAPIResponse(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPIDocument)
+}
@@ -0,0 +1,457 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type openAPICheck struct {
+	// Documented path of the endpoint
+	specPath string
+	// Requested path, differs from specPath when checking unknown endpoints
+	url      string
+	deviceId string
+	status   int
+	// Request headers
+	header map[string]string
+}
+
+// Performs requests against the server's handlers using sample services and
+// clients and validates the responses against the OpenAPI document. Every
+// documented path and response status code has to be exercised, so that the
+// handlers and the document cannot drift apart.
+func TestOpenAPI(t *testing.T) {
+	spec, err := loadOpenAPISpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		knownDevice      = "9f84fbb8-10e8-4b8a-abd2-bb91cbf484df"
+		noServicesDevice = "c1a2b4b4-41d8-4c3e-9a0b-5b5f1d5ad1f0"
+		unknownDevice    = "00000000-0000-0000-0000-000000000000"
+	)
+
+	srvs := []services.Service{
+		{
+			Name: "example-www",
+			IP:   net.ParseIP("192.0.2.1"),
+			ProtoPort: []services.ProtoPort{
+				{Protocol: services.ProtocolTCP, Port: 80},
+				{Protocol: services.ProtocolUDP, Port: 443},
+			},
+			Tags:       []string{"www"},
+			AccessType: []services.AccessType{services.AccessTypeOpenSPA},
+		},
+		{
+			Name:       "example-icmp",
+			IP:         net.ParseIP("2001:db8::1"),
+			ProtoPort:  []services.ProtoPort{{Protocol: services.ProtocolICMP}},
+			AccessType: []services.AccessType{services.AccessTypeOpenSPA},
+		},
+		{
+			Name:       "example-ssh",
+			IP:         net.ParseIP("192.0.2.2"),
+			ProtoPort:  []services.ProtoPort{{Protocol: services.ProtocolTCP, Port: 22}},
+			AccessType: []services.AccessType{services.AccessTypeOpenSPA},
+			Posture:    []posture.Requirement{{Fact: posture.FactDiskEncryption, Op: posture.OpEqual, Value: "true"}},
+		},
+	}
+
+	// Meets the posture requirements of all services
+	goodPosture := map[string]string{posture.Header: posture.Facts{posture.FactDiskEncryption: "true"}.Encode()}
+	badPosture := map[string]string{posture.Header: "not posture"}
+
+	s := &Server{
+		Services: srvs,
+		Clients: map[string]clients.Client{
+			knownDevice: {
+				DeviceId: knownDevice,
+				Services: []clients.ServicePolicy{{Service: srvs[0]}, {Service: srvs[1]}, {Service: srvs[2]}},
+			},
+			noServicesDevice: {DeviceId: noServicesDevice},
+		},
+	}
+
+	// Version of the known device's service set
+	version := newDiscoverV1Response(knownDevice, srvs, nil).Version
+
+	mux := http.NewServeMux()
+	s.routes(mux)
+
+	checks := []openAPICheck{
+		{"/", "/", knownDevice, http.StatusOK, nil},
+		{"/", "/unknown", knownDevice, http.StatusNotFound, nil},
+		{"/discover", "/discover", knownDevice, http.StatusOK, nil},
+		{"/discover", "/discover", unknownDevice, http.StatusUnauthorized, nil},
+		{"/discover", "/discover", noServicesDevice, http.StatusForbidden, nil},
+		{"/discover", "/discover", knownDevice, http.StatusBadRequest, badPosture},
+		{"/v1/", "/v1/", knownDevice, http.StatusOK, nil},
+		{"/v1/", "/v1/unknown", knownDevice, http.StatusNotFound, nil},
+		{"/v1/discover", "/v1/discover", knownDevice, http.StatusOK, nil},
+		{"/v1/discover", "/v1/discover", unknownDevice, http.StatusUnauthorized, nil},
+		{"/v1/discover", "/v1/discover", noServicesDevice, http.StatusForbidden, nil},
+		{"/v1/discover", "/v1/discover", knownDevice, http.StatusNotModified,
+			map[string]string{"If-None-Match": `"` + version + `"`}},
+		{"/v1/discover", "/v1/discover?since=" + version, knownDevice, http.StatusOK, nil},
+		{"/v1/discover", "/v1/discover", knownDevice, http.StatusOK, goodPosture},
+		{"/v1/discover", "/v1/discover", knownDevice, http.StatusBadRequest, badPosture},
+		{"/v1/discover/watch", "/v1/discover/watch", knownDevice, http.StatusOK, nil},
+		{"/v1/discover/watch", "/v1/discover/watch", unknownDevice, http.StatusUnauthorized, nil},
+		{"/v1/discover/watch", "/v1/discover/watch", knownDevice, http.StatusBadRequest, badPosture},
+		{OpenAPIPath, OpenAPIPath, knownDevice, http.StatusOK, nil},
+	}
+
+	covered := make(map[string]bool)
+
+	for _, c := range checks {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: c.deviceId}}},
+		}
+
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+
+		// Streaming responses are ended after their first event
+		ctx, cancel := context.WithCancel(req.Context())
+		req = req.WithContext(ctx)
+
+		rec := &streamRecorder{httptest.NewRecorder(), cancel}
+		mux.ServeHTTP(rec, req)
+		cancel()
+
+		if rec.Code != c.status {
+			t.Errorf("GET %s as %s: expected status %d, got %d", c.url, c.deviceId, c.status, rec.Code)
+			continue
+		}
+
+		if err := spec.validateResponse(c.specPath, http.MethodGet, rec.Code, rec.Body.Bytes()); err != nil {
+			t.Errorf("GET %s: %s", c.url, err)
+		}
+
+		covered[fmt.Sprintf("%s %d", c.specPath, rec.Code)] = true
+	}
+
+	for _, p := range spec.paths() {
+		for _, code := range spec.statusCodes(p, http.MethodGet) {
+			if !covered[fmt.Sprintf("%s %d", p, code)] {
+				t.Errorf("GET %s response %d documented but not checked", p, code)
+			}
+		}
+	}
+}
+
+// Response recorder cancelling the request once the response is flushed
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (r *streamRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	r.cancel()
+}
+
+// Parsed OpenAPI document, used to validate responses against it
+type openAPISpec struct {
+	doc map[string]interface{}
+}
+
+func loadOpenAPISpec() (*openAPISpec, error) {
+	spec := &openAPISpec{}
+	if err := json.Unmarshal(OpenAPIDocument, &spec.doc); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Returns the documented paths, sorted
+func (sp *openAPISpec) paths() []string {
+	paths := make([]string, 0)
+	for p := range object(sp.doc["paths"]) {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Returns the documented response status codes of the operation, sorted
+func (sp *openAPISpec) statusCodes(path, method string) []int {
+	codes := make([]int, 0)
+	op := object(object(object(sp.doc["paths"])[path])[strings.ToLower(method)])
+	for code := range object(op["responses"]) {
+		if c, err := strconv.Atoi(code); err == nil {
+			codes = append(codes, c)
+		}
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// Validates the JSON response body of the operation against the documented
+// schema of the status code.
+func (sp *openAPISpec) validateResponse(path, method string, status int, body []byte) error {
+	pathItem, ok := object(sp.doc["paths"])[path]
+	if !ok {
+		return fmt.Errorf("path %s not documented", path)
+	}
+
+	op, ok := object(pathItem)[strings.ToLower(method)]
+	if !ok {
+		return fmt.Errorf("%s %s not documented", method, path)
+	}
+
+	resp, ok := object(object(op)["responses"])[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("%s %s response %d not documented", method, path, status)
+	}
+
+	resp, err := sp.resolve(object(resp))
+	if err != nil {
+		return err
+	}
+
+	content, ok := object(resp)["content"]
+	if !ok {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s response %d documented without content", method, path, status)
+		}
+		return nil
+	}
+	if media, ok := object(content)["text/event-stream"]; ok {
+		return sp.validateEvents(body, object(object(media)["x-event-data"]),
+			fmt.Sprintf("%s %s response %d", method, path, status))
+	}
+
+	media, ok := object(content)["application/json"]
+	if !ok {
+		return fmt.Errorf("%s %s response %d has no application/json content", method, path, status)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("%s %s response %d is not json: %s", method, path, status, err)
+	}
+
+	return sp.validate(v, object(object(media)["schema"]), "$")
+}
+
+// Validates the JSON data of every server-sent event in the body against the
+// schema. At least one event is expected.
+func (sp *openAPISpec) validateEvents(body []byte, schema map[string]interface{}, desc string) error {
+	events := 0
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		events++
+
+		var v interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &v); err != nil {
+			return fmt.Errorf("%s event %d is not json: %s", desc, events, err)
+		}
+
+		if err := sp.validate(v, schema, fmt.Sprintf("event %d $", events)); err != nil {
+			return err
+		}
+	}
+
+	if events == 0 {
+		return fmt.Errorf("%s has no events", desc)
+	}
+	return nil
+}
+
+// Resolves a local reference (eg. #/components/schemas/PortRange)
+func (sp *openAPISpec) resolve(v map[string]interface{}) (map[string]interface{}, error) {
+	ref, ok := v["$ref"].(string)
+	if !ok {
+		return v, nil
+	}
+
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %s", ref)
+	}
+
+	var cur interface{} = sp.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		next, ok := object(cur)[part]
+		if !ok {
+			return nil, fmt.Errorf("unresolved reference %s", ref)
+		}
+		cur = next
+	}
+
+	return sp.resolve(object(cur))
+}
+
+// Validates the value against the subset of JSON schema used by the document:
+// type, enum, required, properties, additionalProperties, items, minimum,
+// maximum and oneOf.
+func (sp *openAPISpec) validate(v interface{}, schema map[string]interface{}, at string) error {
+	schema, err := sp.resolve(schema)
+	if err != nil {
+		return err
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		var errs []string
+		for _, s := range oneOf {
+			if err := sp.validate(v, object(s), at); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			matched++
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: matches %d of the oneOf schemas (%s)", at, matched, strings.Join(errs, "; "))
+		}
+	}
+
+	if t, ok := schema["type"]; ok {
+		types := make([]string, 0)
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, tt := range t {
+				types = append(types, fmt.Sprint(tt))
+			}
+		}
+
+		matched := false
+		for _, tt := range types {
+			if hasType(v, tt) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", at, strings.Join(types, " or "), jsonType(v))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v not one of %v", at, v, enum)
+		}
+	}
+
+	if n, ok := v.(float64); ok {
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			return fmt.Errorf("%s: %v lower than %v", at, n, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && n > max {
+			return fmt.Errorf("%s: %v higher than %v", at, n, max)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		props := object(schema["properties"])
+
+		if req, ok := schema["required"].([]interface{}); ok {
+			for _, r := range req {
+				if _, ok := v[fmt.Sprint(r)]; !ok {
+					return fmt.Errorf("%s: missing required property %s", at, r)
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			propSchema, ok := props[k]
+			if !ok {
+				if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+					return fmt.Errorf("%s: undocumented property %s", at, k)
+				}
+				continue
+			}
+			if err := sp.validate(v[k], object(propSchema), at+"."+k); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		items, ok := schema["items"]
+		if !ok {
+			return nil
+		}
+		for i, item := range v {
+			if err := sp.validate(item, object(items), fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return jsonType(v) == t
+	}
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+// Returns v as a JSON object, or an empty object if it is not one
+func object(v interface{}) map[string]interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"crypto/x509"
+	"errors"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/policy"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	errUnknownDevice = errors.New("unknown device")
+	errNoServices    = errors.New("not authorized for any services")
+)
+
+// An authenticated discover request, the policy rules are evaluated against
+// its attributes
+type deviceRequest struct {
+	deviceId string
+	cert     *x509.Certificate
+	// Address of the peer, host:port
+	remoteAddr string
+	facts      posture.Facts
+	// Time the rules are evaluated at, the current time if zero
+	time time.Time
+}
+
+// Policy decision on a service for a device
+type serviceDecision struct {
+	service services.Service
+	// Listed for the device in the clients file
+	listed   bool
+	decision policy.Decision
+	matches  []policy.Match
+}
+
+// Returns the services the device is authorized for. These are the services
+// listed for the device in the clients file and the services whose policy
+// rules allow it, the rules of a listed service may deny it. Shared by the
+// HTTPS and gRPC APIs.
+func (s *Server) deviceServices(r deviceRequest) ([]services.Service, error) {
+	decisions, err := s.decideServices(r)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]services.Service, 0, len(decisions))
+	for _, sd := range decisions {
+		if sd.decision.Err != nil {
+			log.WithFields(log.Fields{
+				"deviceId": r.deviceId,
+				"service":  sd.service.Name,
+				"rule":     sd.service.Rules[sd.decision.Rule].String(),
+			}).Warning("Failed to evaluate policy rule, denying service")
+			log.Warning(sd.decision.Err)
+		}
+
+		if sd.decision.Allowed {
+			allowed = append(allowed, sd.service)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return nil, errNoServices
+	}
+
+	return allowed, nil
+}
+
+// Decides on every service for the device, the services listed for it in the
+// clients file first and in their order.
+func (s *Server) decideServices(r deviceRequest) ([]serviceDecision, error) {
+	srvs, clnts := s.config()
+
+	client, ok := clnts[r.deviceId]
+	if !ok {
+		return nil, errUnknownDevice
+	}
+
+	attrs := r.attributes(client)
+
+	listed := make(map[string]bool, len(client.Services))
+	ordered := make([]services.Service, 0, len(srvs))
+	for _, sp := range client.Services {
+		listed[sp.Service.Name] = true
+		ordered = append(ordered, sp.Service)
+	}
+	for _, srv := range srvs {
+		if !listed[srv.Name] {
+			ordered = append(ordered, srv)
+		}
+	}
+
+	decisions := make([]serviceDecision, 0, len(ordered))
+	for _, srv := range ordered {
+		attrs["service"] = serviceAttributes(srv)
+		d, matches := policy.Decide(srv.Rules, attrs, listed[srv.Name])
+		decisions = append(decisions, serviceDecision{srv, listed[srv.Name], d, matches})
+	}
+
+	return decisions, nil
+}
+
+// Returns the attributes of the request available to policy rules, except
+// for the service's
+func (r deviceRequest) attributes(client clients.Client) policy.Attributes {
+	now := r.time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	device := policy.Attributes{
+		"id":     r.deviceId,
+		"label":  client.Label,
+		"groups": client.Groups,
+	}
+
+	peer := policy.Attributes{}
+	if host, _, err := net.SplitHostPort(r.remoteAddr); err == nil {
+		peer["ip"] = host
+	}
+
+	facts := r.facts
+	if facts == nil {
+		facts = posture.Facts{}
+	}
+
+	return policy.Attributes{
+		"device":  device,
+		"cert":    certAttributes(r.cert),
+		"peer":    peer,
+		"posture": map[string]string(facts),
+		"time": policy.Attributes{
+			"hour":    float64(now.Hour()),
+			"minute":  float64(now.Minute()),
+			"weekday": strings.ToLower(now.Weekday().String()),
+		},
+	}
+}
+
+func certAttributes(cert *x509.Certificate) policy.Attributes {
+	if cert == nil {
+		return policy.Attributes{}
+	}
+
+	uris := make([]string, 0, len(cert.URIs))
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+
+	return policy.Attributes{
+		"cn":          cert.Subject.CommonName,
+		"serial":      clients.FormatSerial(cert.SerialNumber),
+		"fingerprint": clients.Fingerprint(cert),
+		"issuer":      cert.Issuer.CommonName,
+		"uris":        uris,
+		"dns":         cert.DNSNames,
+	}
+}
+
+func serviceAttributes(srv services.Service) policy.Attributes {
+	return policy.Attributes{
+		"name": srv.Name,
+		"tags": srv.Tags,
+	}
+}
+
+// Returns true if the device is allowed to perform admin operations
+func (s *Server) isAdmin(deviceId string) bool {
+	for _, a := range s.Admins {
+		if a == deviceId {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the services and clients and notifies the watchers of the change.
+func (s *Server) SetConfig(srvs []services.Service, clnts map[string]clients.Client) {
+	s.mu.Lock()
+	s.Services = srvs
+	s.Clients = clnts
+	s.generation++
+	for w := range s.watchers {
+		// Watchers only need to know that something changed
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"services": len(srvs),
+		"clients":  len(clnts),
+	}).Info("Loaded services and clients")
+}
+
+// Reloads the services and clients using the server's Reload function.
+func (s *Server) ReloadConfig() error {
+	if s.Reload == nil {
+		return errors.New("reload not supported")
+	}
+
+	srvs, clnts, err := s.Reload()
+	if err != nil {
+		return err
+	}
+
+	s.SetConfig(srvs, clnts)
+	return nil
+}
+
+// Returns the configured services and clients
+func (s *Server) config() ([]services.Service, map[string]clients.Client) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Services, s.Clients
+}
+
+// Returns the generation of the services and clients, which changes whenever
+// they do
+func (s *Server) configGeneration() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generation
+}
+
+// Returns a channel receiving a value whenever the config changes and a
+// function to stop watching.
+func (s *Server) watch() (<-chan struct{}, func()) {
+	w := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	if s.watchers == nil {
+		s.watchers = make(map[chan struct{}]bool)
+	}
+	s.watchers[w] = true
+	s.mu.Unlock()
+
+	return w, func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}
+}
+
+// Returns a channel closed once the server shuts down, watchers should stop
+// watching then.
+func (s *Server) shuttingDown() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing == nil {
+		s.closing = make(chan struct{})
+	}
+	return s.closing
+}
+
+// Ends all current and future watches
+func (s *Server) endWatches() {
+	s.shuttingDown()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+	}
+}
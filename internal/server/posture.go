@@ -0,0 +1,92 @@
+package server
+
+import (
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A posture requirement of a service that the device does not meet
+type PostureFailure struct {
+	Service string `json:"service"`
+	Fact    string `json:"fact"`
+	// Condition the fact has to meet, eg. >= 13.4
+	Requirement string `json:"requirement"`
+	// Value submitted by the device, empty if it was not submitted
+	Actual string `json:"actual"`
+}
+
+// Returns the services whose posture requirements the facts meet, and the
+// unmet requirements of the withheld services.
+func checkPosture(srvs []services.Service, facts posture.Facts) ([]services.Service, []PostureFailure) {
+	allowed := make([]services.Service, 0, len(srvs))
+	var failures []PostureFailure
+
+	for _, srv := range srvs {
+		unmet := posture.Unmet(srv.Posture, facts)
+		if len(unmet) == 0 {
+			allowed = append(allowed, srv)
+			continue
+		}
+
+		for _, r := range unmet {
+			failures = append(failures, PostureFailure{srv.Name, r.Fact, r.String(), facts[r.Fact]})
+		}
+	}
+
+	return allowed, failures
+}
+
+// Returned when the posture requirements withhold every service the device is
+// authorized for. It is errNoServices, naming the unmet requirements.
+type postureError struct {
+	failures []PostureFailure
+}
+
+func (e *postureError) Error() string {
+	unmet := make([]string, 0, len(e.failures))
+	for _, f := range e.failures {
+		unmet = append(unmet, f.Service+": "+f.Fact+" "+f.Requirement)
+	}
+	return errNoServices.Error() + ", posture requirements not met (" + strings.Join(unmet, ", ") + ")"
+}
+
+func (e *postureError) Is(target error) bool {
+	return target == errNoServices
+}
+
+// Returns the services whose posture requirements the facts meet along with
+// the unmet requirements, or a postureError if none does
+func requirePosture(srvs []services.Service, facts posture.Facts) ([]services.Service, []PostureFailure, error) {
+	allowed, failures := checkPosture(srvs, facts)
+	if len(allowed) == 0 && len(failures) > 0 {
+		return nil, nil, &postureError{failures}
+	}
+	return allowed, failures, nil
+}
+
+// Returns the posture facts submitted with the request. A malformed posture
+// header writes an error response and returns false.
+func requestPosture(w http.ResponseWriter, req *http.Request) (posture.Facts, bool) {
+	facts, err := posture.Decode(req.Header.Get(posture.Header))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorCodeBadRequest, err.Error())
+		return nil, false
+	}
+	return facts, true
+}
+
+// Returns a channel receiving once the posture submitted at the start of a
+// watch is older than PostureMaxAge, never if unlimited. Watches end then, so
+// that the client reconnects submitting fresh posture. stop releases the
+// timer.
+func (s *Server) postureExpiry() (expired <-chan time.Time, stop func()) {
+	if s.PostureMaxAge <= 0 {
+		return nil, func() {}
+	}
+
+	t := time.NewTimer(s.PostureMaxAge)
+	return t.C, func() { t.Stop() }
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	opensdpv1 "github.com/greenstatic/opensdp/api/opensdp/v1"
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Services requiring disk encryption and an OS version, and none
+var postureServices = []services.Service{
+	{
+		Name: "encrypted",
+		IP:   net.ParseIP("192.0.2.1"),
+		Posture: []posture.Requirement{
+			{Fact: posture.FactDiskEncryption, Op: posture.OpEqual, Value: "true"},
+			{Fact: posture.FactOSVersion, Op: posture.OpGreaterEqual, Value: "13.4"},
+		},
+	},
+	{
+		Name: "open",
+		IP:   net.ParseIP("192.0.2.2"),
+	},
+}
+
+func TestCheckPosture(t *testing.T) {
+	tests := []struct {
+		name     string
+		facts    posture.Facts
+		allowed  []string
+		failures []PostureFailure
+	}{
+		{"met", posture.Facts{posture.FactDiskEncryption: "true", posture.FactOSVersion: "13.4.0"},
+			[]string{"encrypted", "open"}, nil},
+		{"missing facts", nil, []string{"open"}, []PostureFailure{
+			{"encrypted", posture.FactDiskEncryption, "== true", ""},
+			{"encrypted", posture.FactOSVersion, ">= 13.4", ""},
+		}},
+		{"old version", posture.Facts{posture.FactDiskEncryption: "true", posture.FactOSVersion: "13.3.9"},
+			[]string{"open"}, []PostureFailure{{"encrypted", posture.FactOSVersion, ">= 13.4", "13.3.9"}}},
+	}
+
+	for _, tt := range tests {
+		allowed, failures := checkPosture(postureServices, tt.facts)
+
+		var names []string
+		for _, srv := range allowed {
+			names = append(names, srv.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.allowed, ",") {
+			t.Errorf("%s: allowed %v, want %v", tt.name, names, tt.allowed)
+		}
+
+		if len(failures) != len(tt.failures) {
+			t.Errorf("%s: failures %+v, want %+v", tt.name, failures, tt.failures)
+			continue
+		}
+		for i := range failures {
+			if failures[i] != tt.failures[i] {
+				t.Errorf("%s: failure %+v, want %+v", tt.name, failures[i], tt.failures[i])
+			}
+		}
+	}
+
+	// Withholding every service is errNoServices
+	_, _, err := requirePosture(postureServices[:1], posture.Facts{posture.FactDiskEncryption: "false"})
+	if !errors.Is(err, errNoServices) {
+		t.Fatalf("requirePosture = %v, want errNoServices", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "encrypted: disk-encryption == true") {
+		t.Errorf("error %q does not name the unmet requirement", msg)
+	}
+
+	if srvs, _, err := requirePosture(postureServices, nil); err != nil || len(srvs) != 1 {
+		t.Errorf("requirePosture = %v, %v", srvs, err)
+	}
+}
+
+// Discover requests fail with no_services once posture withholds every
+// service, like for devices without services, while watches get the empty set
+func TestPostureWithholdsAll(t *testing.T) {
+	s := &Server{
+		Services: postureServices,
+		Clients: map[string]clients.Client{
+			grpcDevice: {DeviceId: grpcDevice, Services: []clients.ServicePolicy{{Service: postureServices[0]}}},
+		},
+	}
+	mux := http.NewServeMux()
+	s.routes(mux)
+
+	oldOS := posture.Facts{posture.FactDiskEncryption: "true", posture.FactOSVersion: "12"}
+
+	for _, path := range []string{"/discover", "/v1/discover"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{deviceCert(grpcDevice)}}
+		req.Header.Set(posture.Header, oldOS.Encode())
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if rec.Code != http.StatusForbidden || resp.Code != ErrorCodeNoServices ||
+			!strings.Contains(resp.Error, "os-version >= 13.4") {
+			t.Errorf("%s: got %d %+v", path, rec.Code, resp)
+		}
+	}
+
+	g := &grpcServer{s: s}
+	ctx := peerContext(context.Background(), deviceCert(grpcDevice))
+	if _, err := g.Discover(ctx, &opensdpv1.DiscoverRequest{Posture: oldOS}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("gRPC Discover: got %v", err)
+	}
+
+	resp, err := g.discover(deviceRequest{deviceId: grpcDevice, facts: oldOS}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetServices()) != 0 || len(resp.GetPostureFailures()) != 1 {
+		t.Errorf("watch got %v", resp)
+	}
+}
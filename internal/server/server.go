@@ -1,92 +1,263 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/json"
+	"errors"
 	"github.com/greenstatic/opensdp/internal/clients"
 	"github.com/greenstatic/opensdp/internal/services"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
+	"google.golang.org/grpc"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
 var (
-	Version = "0.1.0"
+	Version = "0.2.0"
 )
 
+// Server version since which the v1 API (/v1/) is supported. Clients compare
+// it with the version field of the root response.
+const V1MinVersion = "0.2.0"
+
+type RootResponse struct {
+	Success  bool   `json:"success"`
+	Msg      string `json:"msg"`
+	DeviceId string `json:"deviceId"`
+	Datetime string `json:"datetime"`
+	Version  string `json:"version"`
+}
+
 type Server struct {
 	CAPath         string
 	ServerCertPath string
 	ServerKeyPath  string
 	Bind           string
 	Port           string
-	Services       []services.Service
-	Clients        map[string]clients.Client
+	// Port of the gRPC API, empty disables it
+	GRPCPort string
+	Services []services.Service
+	Clients  map[string]clients.Client
+	// Device IDs allowed to perform admin operations
+	Admins []string
+	// How device IDs are extracted from client certificates
+	Identity  Identity
+	TLSPolicy TLSPolicy
+	// Watches longer than this are ended, so that the posture submitted when
+	// connecting is re-collected, zero means never
+	PostureMaxAge time.Duration
+	// Reads the services and clients again, used by ReloadConfig
+	Reload func() ([]services.Service, map[string]clients.Client, error)
+
+	// Guards Services, Clients, generation, watchers and closing
+	mu sync.RWMutex
+	// Incremented whenever the services and clients change
+	generation uint64
+	watchers   map[chan struct{}]bool
+	// Closed on shutdown to end the watchers
+	closing chan struct{}
+
+	// Guards serviceSets and history
+	cacheMu     sync.Mutex
+	serviceSets map[string]*serviceSet
+	history     serviceSetHistory
+
+	// Guards certs, httpServer, grpcServer and listeners
+	lifecycleMu sync.Mutex
+	certs       *certStore
+	httpServer  *http.Server
+	grpcServer  *grpc.Server
+	listeners   map[string]net.Listener
 }
 
-func rootResponse(w http.ResponseWriter, req *http.Request) {
-	cn := req.TLS.PeerCertificates[0].Subject.CommonName
+func (s *Server) rootResponse(w http.ResponseWriter, req *http.Request) {
+	// The root patterns match all paths not handled by other handlers
+	if req.URL.Path != "/" && req.URL.Path != "/v1/" {
+		writeError(w, http.StatusNotFound, ErrorCodeNotFound, "unknown endpoint")
+		return
+	}
+
+	// Empty for certificates without a device ID
+	deviceId, _ := s.Identity.DeviceId(req.TLS.PeerCertificates[0])
 
-	json.NewEncoder(w).Encode(struct {
-		Success  bool   `json:"success"`
-		Msg      string `json:"msg"`
-		DeviceId string `json:"deviceId"`
-		Datetime string `json:"datetime"`
-		Version  string `json:"version"`
-	}{
+	writeJSON(w, RootResponse{
 		true,
 		"OpenSDP Server",
-		cn,
+		deviceId,
 		time.Now().Format(time.RFC3339),
 		Version,
 	})
 
 }
 
-func (s *Server) Start() {
+// Registers the server's handlers on the mux
+func (s *Server) routes(mux *http.ServeMux) {
+	// Legacy API
+	mux.HandleFunc("/discover", s.discoverResponseWrapper())
+	mux.HandleFunc("/", s.rootResponse)
+
+	// v1 API
+	mux.HandleFunc("/v1/discover", s.discoverV1ResponseWrapper())
+	mux.HandleFunc("/v1/discover/watch", s.discoverWatchWrapper())
+	mux.HandleFunc("/v1/", s.rootResponse)
+
+	mux.HandleFunc(OpenAPIPath, openAPIResponse)
+}
+
+// Starts serving the HTTPS API (and the gRPC API if configured) on the
+// listeners passed by socket activation or a previous process, otherwise on
+// new ones. Blocks until the server fails or is shut down, in which case nil
+// is returned.
+func (s *Server) Start() error {
 	// Adapted from: https://github.com/levigross/go-mutual-tls
 
-	certBytes, err := ioutil.ReadFile(s.CAPath)
+	certs, err := newCertStore(s.CAPath, s.ServerCertPath, s.ServerKeyPath)
 	if err != nil {
-		log.WithField("caCert", s.CAPath).Error("Failed to read CA cert")
-		log.Error(err)
-		return
+		log.WithFields(log.Fields{
+			"caCert": s.CAPath,
+			"cert":   s.ServerCertPath,
+			"key":    s.ServerKeyPath,
+		}).Error("Failed to load certificates")
+		return err
 	}
 
-	clientCertPool := x509.NewCertPool()
-	if ok := clientCertPool.AppendCertsFromPEM(certBytes); !ok {
-		log.Error("Failed to add CA cert to our cert pool")
-		log.Error(err)
+	if err := s.Identity.Validate(); err != nil {
+		log.Error("Invalid identity config")
+		return err
 	}
 
 	tlsConfig := &tls.Config{
-		ClientAuth:               tls.RequireAndVerifyClientCert,
-		ClientCAs:                clientCertPool,
-		CipherSuites:             []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
-		PreferServerCipherSuites: true,
-		MinVersion:               tls.VersionTLS12,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		GetCertificate: certs.getCertificate,
+	}
+
+	if err := s.TLSPolicy.Apply(tlsConfig); err != nil {
+		log.Error("Invalid TLS policy")
+		return err
+	}
+
+	// Set explicitly, since the per-handshake configs are derived from it
+	tlsConfig.NextProtos = []string{"http/1.1"}
+	if s.TLSPolicy.HTTP2(tlsConfig) {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	// The client CAs are looked up for each handshake
+	tlsConfig.GetConfigForClient = certs.configForClient(tlsConfig)
+
+	inherited, err := inheritedListeners()
+	if err != nil {
+		log.Error("Failed to use inherited listeners")
+		return err
 	}
 
-	tlsConfig.BuildNameToCertificate()
+	ln, err := listen(inherited, ListenerHTTPS, net.JoinHostPort(s.Bind, s.Port))
+	if err != nil {
+		return err
+	}
 
-	http.HandleFunc("/discover", s.discoverResponseWrapper())
-	http.HandleFunc("/", rootResponse)
+	mux := http.NewServeMux()
+	s.routes(mux)
 
 	httpServer := &http.Server{
-		Addr:      net.JoinHostPort(s.Bind, s.Port),
+		Handler:   mux,
 		TLSConfig: tlsConfig,
 	}
 
-	// Disable HTTP/2 support due to cipher suite error
-	httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	if !s.TLSPolicy.HTTP2(tlsConfig) {
+		// An empty map disables HTTP/2
+		httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	s.lifecycleMu.Lock()
+	s.certs = certs
+	s.httpServer = httpServer
+	s.listeners = map[string]net.Listener{ListenerHTTPS: ln}
+	s.lifecycleMu.Unlock()
+
+	if s.GRPCPort != "" || inherited[ListenerGRPC] != nil {
+		grpcLn, err := listen(inherited, ListenerGRPC, net.JoinHostPort(s.Bind, s.GRPCPort))
+		if err != nil {
+			ln.Close()
+			return err
+		}
+
+		s.lifecycleMu.Lock()
+		s.grpcServer = s.startGRPC(certs, tlsConfig, grpcLn)
+		s.listeners[ListenerGRPC] = grpcLn
+		s.lifecycleMu.Unlock()
+	}
 
 	log.WithFields(log.Fields{
-		"bind": s.Bind,
-		"port": s.Port,
+		"addr":       ln.Addr().String(),
+		"tlsProfile": s.TLSPolicy.Profile,
+		"http2":      s.TLSPolicy.HTTP2(tlsConfig),
 	}).Info("Starting server")
 
-	log.Fatalln(httpServer.ListenAndServeTLS(s.ServerCertPath, s.ServerKeyPath))
+	go certs.watch(s.shuttingDown())
+
+	notifyReady()
+
+	// The certificate is part of the TLS config
+	err = httpServer.ServeTLS(ln, "", "")
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stops accepting connections and waits for in-flight requests to finish,
+// until ctx is done. Open watch streams are closed right away, clients
+// reconnect to another server (or the process that took over the listeners).
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	httpServer, grpcServer := s.httpServer, s.grpcServer
+	s.lifecycleMu.Unlock()
+
+	// Streaming handlers never finish on their own
+	s.endWatches()
+
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	if httpServer == nil {
+		return nil
+	}
+
+	return httpServer.Shutdown(ctx)
+}
+
+// Reloads the server certificate and client CAs if their files changed,
+// instead of waiting for them to be noticed.
+func (s *Server) ReloadCertificates() error {
+	s.lifecycleMu.Lock()
+	certs := s.certs
+	s.lifecycleMu.Unlock()
+
+	if certs == nil {
+		return errors.New("server not started")
+	}
+
+	changed, err := certs.reload()
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		log.Info("Reloaded the server certificate and client CAs")
+	}
+	return nil
 }
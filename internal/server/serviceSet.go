@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/greenstatic/opensdp/internal/services"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Number of service set versions remembered for delta responses
+const maxServiceSetVersions = 1024
+
+// A device's effective service set, cached while its key stays the same so
+// that repeated discover requests are neither hashed nor encoded again.
+type serviceSet struct {
+	// See serviceSetKey
+	key      string
+	response DiscoverV1Response
+	// Encoded response
+	body []byte
+}
+
+// Versions of service sets that were served, used to compute deltas. The
+// versions are hashes of the service sets, so devices with the same services
+// share them.
+type serviceSetHistory struct {
+	sets  map[string][]DiscoverV1Service
+	order []string
+}
+
+// Returns the version of the service set, a hash of its encoded services and
+// posture failures. Equal service sets have the same version regardless of
+// the device.
+func serviceSetVersion(srvs []DiscoverV1Service, failures []PostureFailure) string {
+	h := sha256.New()
+	data, _ := json.Marshal(srvs)
+	h.Write(data)
+	if len(failures) > 0 {
+		data, _ = json.Marshal(failures)
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Returns the key of a service set given the config generation it was
+// resolved from, the names of the services given to the device and the
+// posture failures. Services don't change within a generation, so sets with
+// equal keys are equal.
+func serviceSetKey(generation uint64, srvs []services.Service, failures []PostureFailure) string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatUint(generation, 10))
+	for _, srv := range srvs {
+		b.WriteString("\x00")
+		b.WriteString(srv.Name)
+	}
+	for _, f := range failures {
+		b.WriteString("\x01")
+		b.WriteString(strings.Join([]string{f.Service, f.Fact, f.Requirement, f.Actual}, "\x00"))
+	}
+	return b.String()
+}
+
+// Returns the device's service set for the request. The services are decided
+// for every request, since policy rules may depend on the peer address and the
+// time, but the response is only built, hashed and encoded when the set's key
+// changes.
+func (s *Server) deviceServiceSet(r deviceRequest) (*serviceSet, error) {
+	// Read before deciding, so that a set is never cached under a newer
+	// generation than it was resolved from
+	generation := s.configGeneration()
+
+	srvs, err := s.deviceServices(r)
+	if err != nil {
+		return nil, err
+	}
+
+	srvs, failures, err := requirePosture(srvs, r.facts)
+	if err != nil {
+		return nil, err
+	}
+	key := serviceSetKey(generation, srvs, failures)
+
+	s.cacheMu.Lock()
+	set, ok := s.serviceSets[r.deviceId]
+	s.cacheMu.Unlock()
+
+	if ok && set.key == key {
+		return set, nil
+	}
+
+	resp := discoverV1Response(r.deviceId, srvs, failures)
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	set = &serviceSet{key, resp, append(body, '\n')}
+
+	s.cacheMu.Lock()
+	if s.serviceSets == nil {
+		s.serviceSets = make(map[string]*serviceSet)
+	}
+	s.serviceSets[r.deviceId] = set
+	s.history.add(resp.Version, resp.Services)
+	s.cacheMu.Unlock()
+
+	return set, nil
+}
+
+// Remembers the service set version, forgetting the oldest one once
+// maxServiceSetVersions are remembered.
+func (h *serviceSetHistory) add(version string, srvs []DiscoverV1Service) {
+	if h.sets == nil {
+		h.sets = make(map[string][]DiscoverV1Service)
+	}
+
+	if _, ok := h.sets[version]; ok {
+		return
+	}
+
+	if len(h.order) >= maxServiceSetVersions {
+		delete(h.sets, h.order[0])
+		h.order = h.order[1:]
+	}
+
+	h.sets[version] = srvs
+	h.order = append(h.order, version)
+}
+
+// Returns the changes of the set since the version, false if the version is
+// not remembered.
+func (s *Server) serviceSetDelta(set *serviceSet, since string) (DiscoverV1DeltaResponse, bool) {
+	s.cacheMu.Lock()
+	old, ok := s.history.sets[since]
+	s.cacheMu.Unlock()
+
+	if !ok {
+		return DiscoverV1DeltaResponse{}, false
+	}
+
+	delta := DiscoverV1DeltaResponse{
+		Success:  true,
+		DeviceId: set.response.DeviceId,
+		Version:  set.response.Version,
+		Since:    since,
+		Added:    make([]DiscoverV1Service, 0),
+		Changed:  make([]DiscoverV1Service, 0),
+		Removed:  make([]string, 0),
+
+		PostureFailures: set.response.PostureFailures,
+	}
+
+	oldByName := make(map[string]DiscoverV1Service, len(old))
+	for _, srv := range old {
+		oldByName[srv.Name] = srv
+	}
+
+	for _, srv := range set.response.Services {
+		o, ok := oldByName[srv.Name]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, srv)
+		case !reflect.DeepEqual(o, srv):
+			delta.Changed = append(delta.Changed, srv)
+		}
+		delete(oldByName, srv.Name)
+	}
+
+	for _, srv := range old {
+		if _, ok := oldByName[srv.Name]; ok {
+			delta.Removed = append(delta.Removed, srv.Name)
+		}
+	}
+
+	return delta, true
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"github.com/greenstatic/opensdp/internal/clients"
+	"github.com/greenstatic/opensdp/internal/posture"
+	"github.com/greenstatic/opensdp/internal/services"
+	"testing"
+)
+
+func TestDeviceServiceSet(t *testing.T) {
+	g := newGRPCTestServer()
+	s := g.s
+	r := deviceRequest{deviceId: grpcDevice, cert: deviceCert(grpcDevice)}
+
+	first, err := s.deviceServiceSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.response.Services) != 1 {
+		t.Fatalf("got %+v", first.response)
+	}
+
+	// Unchanged sets are served from the cache
+	again, err := s.deviceServiceSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Error("unchanged set built again")
+	}
+
+	// Reloading the same config keeps the version
+	s.SetConfig(s.Services, s.Clients)
+	reloaded, err := s.deviceServiceSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded == first || reloaded.response.Version != first.response.Version {
+		t.Errorf("reloaded set %p version %s, first %p version %s",
+			reloaded, reloaded.response.Version, first, first.response.Version)
+	}
+
+	// Changed services change the version and the delta lists them
+	s.SetConfig(grpcServices, map[string]clients.Client{
+		grpcDevice: {
+			DeviceId: grpcDevice,
+			Services: []clients.ServicePolicy{{Service: grpcServices[0]}, {Service: grpcServices[1]}},
+		},
+	})
+	changed, err := s.deviceServiceSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.response.Version == first.response.Version {
+		t.Error("version unchanged")
+	}
+
+	delta, ok := s.serviceSetDelta(changed, first.response.Version)
+	if !ok || len(delta.Added) != 1 || delta.Added[0].Name != "example-ssh" ||
+		len(delta.Changed) != 0 || len(delta.Removed) != 0 {
+		t.Errorf("got delta %+v", delta)
+	}
+
+	// Posture failures are part of the set
+	srvs := append([]services.Service(nil), grpcServices...)
+	srvs[1].Posture = []posture.Requirement{{Fact: posture.FactFirewall, Op: posture.OpEqual, Value: "true"}}
+	s.SetConfig(srvs, map[string]clients.Client{
+		grpcDevice: {
+			DeviceId: grpcDevice,
+			Services: []clients.ServicePolicy{{Service: srvs[0]}, {Service: srvs[1]}},
+		},
+	})
+	r.facts = posture.Facts{posture.FactFirewall: "false"}
+	withheld, err := s.deviceServiceSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withheld.response.Services) != 1 || len(withheld.response.PostureFailures) != 1 {
+		t.Errorf("got %+v", withheld.response)
+	}
+
+	r.facts = posture.Facts{posture.FactFirewall: "true"}
+	met, err := s.deviceServiceSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if met == withheld || len(met.response.Services) != 2 {
+		t.Errorf("got %+v", met.response)
+	}
+}
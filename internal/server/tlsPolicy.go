@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// TLS profiles, following Mozilla's server side TLS recommendations
+const (
+	// TLS 1.3 only
+	TLSProfileModern = "modern"
+	// TLS 1.2 with forward secret AEAD cipher suites and TLS 1.3
+	TLSProfileIntermediate = "intermediate"
+)
+
+// TLS policy of the HTTPS and gRPC APIs. Unset fields use the profile's
+// values. Server keys may be RSA, ECDSA or Ed25519.
+type TLSPolicy struct {
+	// modern or intermediate (default)
+	Profile string
+	// Minimum TLS version, 1.2 or 1.3
+	MinVersion string
+	// Allowed TLS 1.2 cipher suites by name (eg.
+	// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256), TLS 1.3 suites are not
+	// configurable
+	CipherSuites []string
+	// Key exchange curves in order of preference (eg. X25519, P-256)
+	Curves []string
+	// Disables HTTP/2 even if the policy permits it
+	DisableHTTP2 bool
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519MLKEM768": tls.X25519MLKEM768,
+	"X25519":         tls.X25519,
+	"P-256":          tls.CurveP256,
+	"P-384":          tls.CurveP384,
+	"P-521":          tls.CurveP521,
+}
+
+// TLS 1.2 cipher suites of the intermediate profile
+var intermediateCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Applies the policy's minimum version, cipher suites and curves to the
+// config. Returns an error for unknown profiles, versions, curves and for
+// unknown or insecure cipher suites.
+func (p TLSPolicy) Apply(cfg *tls.Config) error {
+	switch p.Profile {
+	case TLSProfileModern:
+		cfg.MinVersion = tls.VersionTLS13
+	case TLSProfileIntermediate, "":
+		cfg.MinVersion = tls.VersionTLS12
+		cfg.CipherSuites = intermediateCipherSuites
+	default:
+		return fmt.Errorf("unknown tls profile %s, expected %s or %s",
+			p.Profile, TLSProfileModern, TLSProfileIntermediate)
+	}
+
+	if p.MinVersion != "" {
+		v, ok := tlsVersions[p.MinVersion]
+		if !ok {
+			return fmt.Errorf("unsupported tls version %s, expected 1.2 or 1.3", p.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if len(p.CipherSuites) > 0 {
+		if cfg.MinVersion == tls.VersionTLS13 {
+			return fmt.Errorf("cipher suites cannot be configured for TLS 1.3")
+		}
+
+		suites, err := cipherSuiteIDs(p.CipherSuites)
+		if err != nil {
+			return err
+		}
+		cfg.CipherSuites = suites
+	}
+
+	if len(p.Curves) > 0 {
+		cfg.CurvePreferences = make([]tls.CurveID, 0, len(p.Curves))
+		for _, name := range p.Curves {
+			c, ok := tlsCurves[name]
+			if !ok {
+				return fmt.Errorf("unsupported curve %s", name)
+			}
+			cfg.CurvePreferences = append(cfg.CurvePreferences, c)
+		}
+	}
+
+	return nil
+}
+
+// Returns true if HTTP/2 can be offered with the config. HTTP/2 requires
+// TLS 1.3 or the TLS_ECDHE_*_WITH_AES_128_GCM_SHA256 cipher suite (RFC 7540
+// section 9.2.2).
+func (p TLSPolicy) HTTP2(cfg *tls.Config) bool {
+	if p.DisableHTTP2 {
+		return false
+	}
+
+	if cfg.MinVersion == tls.VersionTLS13 || cfg.CipherSuites == nil {
+		return true
+	}
+
+	for _, id := range cfg.CipherSuites {
+		if id == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || id == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IDs of the named cipher suites, rejecting insecure ones.
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	secure := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		secure[cs.Name] = cs.ID
+	}
+
+	insecure := make(map[string]bool)
+	for _, cs := range tls.InsecureCipherSuites() {
+		insecure[cs.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+
+		if insecure[name] {
+			return nil, fmt.Errorf("insecure cipher suite %s", name)
+		}
+
+		id, ok := secure[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
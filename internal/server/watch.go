@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Interval of the keep-alive comments sent on idle watch streams. The service
+// set is resolved again at the same interval, since policy rules may depend on
+// the time.
+const watchKeepAlive = 30 * time.Second
+
+// Wrapper handler for the v1 discover watch endpoint. Streams server-sent
+// events, each containing a DiscoverV1Response with the device's complete
+// service set. The first event is sent immediately and a new one whenever the
+// device's services change. Devices not authorized for any services receive
+// an empty set, since they may be authorized later on. The stream ends once
+// the posture is older than PostureMaxAge.
+func (s *Server) discoverWatchWrapper() func(w http.ResponseWriter, req *http.Request) {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		cert := req.TLS.PeerCertificates[0]
+
+		deviceId, err := s.authenticate(cert)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, err.Error())
+			return
+		}
+
+		facts, ok := requestPosture(w, req)
+		if !ok {
+			return
+		}
+
+		r := newDeviceRequest(deviceId, req, facts)
+		if _, err := s.deviceServices(r); err == errUnknownDevice {
+			writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, err.Error())
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "streaming not supported")
+			return
+		}
+
+		changed, stop := s.watch()
+		defer stop()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		keepAlive := time.NewTicker(watchKeepAlive)
+		defer keepAlive.Stop()
+
+		postureExpired, stopExpiry := s.postureExpiry()
+		defer stopExpiry()
+
+		log.WithField("deviceId", deviceId).Debug("Device watching services")
+
+		var last []byte
+		for {
+			// The device may have been removed or bound to another certificate,
+			// the client gets unauthorized on reconnect
+			if _, err := s.authenticate(cert); err != nil {
+				return
+			}
+
+			srvs, err := s.deviceServices(r)
+			if err == errUnknownDevice {
+				return
+			}
+
+			data, err := json.Marshal(newDiscoverV1Response(deviceId, srvs, facts))
+			if err != nil {
+				return
+			}
+
+			if !bytes.Equal(data, last) {
+				fmt.Fprintf(w, "event: services\ndata: %s\n\n", data)
+				flusher.Flush()
+				last = data
+			}
+
+			select {
+			case <-req.Context().Done():
+				log.WithField("deviceId", deviceId).Debug("Device stopped watching services")
+				return
+			case <-s.shuttingDown():
+				return
+			case <-postureExpired:
+				log.WithField("deviceId", deviceId).Debug("Posture too old, ending watch")
+				return
+			case <-changed:
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"errors"
 	"fmt"
+	"github.com/greenstatic/opensdp/internal/policy"
+	"github.com/greenstatic/opensdp/internal/posture"
 	"net"
 	"strconv"
 	"strings"
@@ -136,6 +138,12 @@ type Service struct {
 	ProtoPort  []ProtoPort
 	Tags       []string
 	AccessType []AccessType
+	// Posture the device has to meet to be given the service
+	Posture []posture.Requirement
+	// Policy rules deciding which devices are given the service, evaluated
+	// in order. Without a matching rule the devices listing the service in
+	// the clients file are given it.
+	Rules []policy.Rule
 }
 
 // Interface that implements function to gain access to a service